@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http" // HTTP transport wrapping
+	"strings"  // Password redaction
+)
+
+// basicAuthTransport adds HTTP Basic Auth credentials to the requests sent through it to
+// one host.
+type basicAuthTransport struct {
+	base     http.RoundTripper // Transport performing the actual request
+	host     string            // Host (with port, if any) the credentials are sent to
+	user     string            // Basic Auth user name
+	password string            // Basic Auth password, never logged
+}
+
+// RoundTrip sends the request, with the credentials when it goes to the host of the
+// transport, and redacts the password from any error. Requests to other hosts, e.g. a CDN
+// serving the PDFs or the target of a redirect, never see the credentials.
+func (transport *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.EqualFold(req.URL.Host, transport.host) {
+		// A RoundTripper must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(transport.user, transport.password)
+	}
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, &redactedError{err: err, secret: transport.password}
+	}
+	return resp, nil
+}
+
+// withBasicAuth makes client send the given credentials with every request to host, e.g.
+// the host of the --base-url.
+func withBasicAuth(client *http.Client, host string, user string, password string) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &basicAuthTransport{base: base, host: host, user: user, password: password}
+	return client
+}
+
+// redactedError hides a secret in the message of the wrapped error.
+type redactedError struct {
+	err    error
+	secret string
+}
+
+// Error returns the wrapped message with every occurrence of the secret replaced by ***.
+func (e *redactedError) Error() string {
+	if e.secret == "" {
+		return e.err.Error()
+	}
+	return strings.ReplaceAll(e.err.Error(), e.secret, "***")
+}
+
+// Unwrap exposes the wrapped error to errors.Is and errors.As.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"          // Requests and status codes
+	"net/http/httptest" // Built-in mock servers
+	"net/url"           // Server hosts
+	"testing"           // Test framework
+)
+
+func TestBasicAuthOnlyForHost(t *testing.T) {
+	// Both servers answer whether the request carried credentials
+	authorized := make(map[string]bool)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		authorized[r.Host] = ok && user == "alice" && password == "secret"
+	})
+	portal := httptest.NewServer(handler)
+	defer portal.Close()
+	cdn := httptest.NewServer(handler)
+	defer cdn.Close()
+	portalHost, _ := url.Parse(portal.URL)
+	client := withBasicAuth(newHTTPClient(htmlRequestTimeout), portalHost.Host, "alice", "secret")
+
+	for _, serverURL := range []string{portal.URL, cdn.URL} {
+		req, _ := http.NewRequest("GET", serverURL+"/a.pdf", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if req.Header.Get("Authorization") != "" {
+			t.Error("RoundTrip modified the caller's request")
+		}
+	}
+	cdnHost, _ := url.Parse(cdn.URL)
+	if !authorized[portalHost.Host] {
+		t.Error("credentials not sent to the --base-url host")
+	}
+	if authorized[cdnHost.Host] {
+		t.Error("credentials sent to another host")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"           // Cancellation of the rounds
+	"flag"              // Command line flag parsing
+	"fmt"               // Printing the throughput table
+	"io"                // Silencing the scrape log
+	"log"               // Redirecting the scrape log
+	"log/slog"          // Logging errors
+	"net/http"          // Mock search pages
+	"net/http/httptest" // Built-in mock server
+	"os"                // Temporary output directory
+	"os/signal"         // Interrupt handling
+	"path/filepath"     // Output files of the rounds
+	"runtime"           // Goroutine and memory sampling
+	"strconv"           // Parsing the page offsets and concurrency levels
+	"sync"              // Waiting for the sampler
+	"sync/atomic"       // Counters of the mock server
+	"syscall"           // Termination signal
+	"time"              // Latency and durations
+)
+
+// Defaults of the benchmark subcommand.
+const (
+	benchmarkPages          = 1000                  // Canned search pages served by the mock server
+	benchmarkConcurrency    = "1,2,5,10,20,50,100"  // Concurrency levels compared in the table
+	benchmarkLatency        = 20 * time.Millisecond // Delay of every mock answer, like a distant server
+	benchmarkSampleInterval = 10 * time.Millisecond // How often goroutines and memory are sampled
+)
+
+// benchmarkServer serves canned SDS search result pages of documentsPerPage cards each,
+// counting the requests in flight and the bytes sent.
+type benchmarkServer struct {
+	*httptest.Server
+	latency  time.Duration // Delay before every answer
+	inFlight atomic.Int64  // Requests being answered right now
+	bytes    atomic.Int64  // Bytes of page bodies sent
+}
+
+// newBenchmarkServer starts a mock search server answering after latency.
+func newBenchmarkServer(latency time.Duration) *benchmarkServer {
+	server := &benchmarkServer{latency: latency}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.servePage))
+	return server
+}
+
+// servePage answers a search page request with the cards of the documents from its
+// first parameter on, linking to PDFs on the mock server.
+func (server *benchmarkServer) servePage(w http.ResponseWriter, r *http.Request) {
+	server.inFlight.Add(1)
+	defer server.inFlight.Add(-1)
+	time.Sleep(server.latency)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("first")) // Page 0 for a missing offset
+	links := make([]SDSLink, documentsPerPage)
+	for index := range links {
+		document := offset + index
+		links[index] = SDSLink{
+			URL:          fmt.Sprintf("http://%s/-/media/sds/benchmark-%d.pdf", r.Host, document),
+			Language:     "en",
+			ProductName:  fmt.Sprintf("Benchmark Product %d", document),
+			CASNumber:    "7173-51-5",
+			RevisionDate: "01/02/2024",
+		}
+	}
+	page, err := renderResultCards(links, "http://"+r.Host+r.URL.RequestURI())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	written, _ := io.WriteString(w, page)
+	server.bytes.Add(int64(written))
+}
+
+// benchmarkResult is the outcome of one scrape of the mock server.
+type benchmarkResult struct {
+	Concurrency    int           // Page requests allowed in flight
+	Pages          int64         // Pages scraped
+	Links          int           // Links extracted from the scraped pages
+	Bytes          int64         // Bytes of page bodies received
+	Duration       time.Duration // Time of the scrape and the link extraction
+	AvgInFlight    float64       // Average requests in flight at the server
+	PeakGoroutines int           // Most goroutines sampled
+	PeakHeapBytes  uint64        // Most heap memory in use sampled
+}
+
+// pagesPerSecond returns the scrape throughput in pages.
+func (result benchmarkResult) pagesPerSecond() float64 {
+	return float64(result.Pages) / result.Duration.Seconds()
+}
+
+// megabytesPerSecond returns the scrape throughput in MB of page bodies.
+func (result benchmarkResult) megabytesPerSecond() float64 {
+	return float64(result.Bytes) / 1e6 / result.Duration.Seconds()
+}
+
+// utilization returns the share of the concurrency slots that were busy with a request
+// on average; the rest of the time the workers waited for the queue, the disk or the parser.
+func (result benchmarkResult) utilization() float64 {
+	return result.AvgInFlight / float64(result.Concurrency)
+}
+
+// runBenchmark implements the "benchmark" subcommand: it starts a mock server serving
+// canned search pages, runs the scrape pipeline against it at every concurrency level and
+// prints a throughput table, as a repeatable baseline for performance work. It returns
+// the process exit code.
+func runBenchmark(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("benchmark", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pages := flags.Int("pages", benchmarkPages, "number of canned search pages to scrape per round")
+	concurrencyLevels := flags.String("concurrency", benchmarkConcurrency, "comma-separated concurrency levels to compare, from 1 to 100")
+	latency := flags.Duration("latency", benchmarkLatency, "delay of every mock server answer")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+	levels, err := parseConcurrencyLevels(*concurrencyLevels)
+	if err != nil {
+		slog.Error("benchmark: invalid --concurrency", "error", err)
+		return 2
+	}
+	if maxPages := (totalSDSDocuments + documentsPerPage - 1) / documentsPerPage; *pages < 1 || *pages > maxPages {
+		slog.Error("benchmark: --pages out of range", "pages", *pages, "min", 1, "max", maxPages)
+		return 2
+	}
+
+	// Scrape into a temporary directory, removed with everything in it at the end
+	outputDir, err := os.MkdirTemp("", "ecolab-benchmark-")
+	if err != nil {
+		slog.Error("Error creating benchmark directory", "error", err)
+		return 1
+	}
+	defer os.RemoveAll(outputDir)
+	server := newBenchmarkServer(*latency)
+	defer server.Close()
+	// Point the scraper at the mock server for the duration of the benchmark
+	previousBaseURL := BaseURL
+	BaseURL = server.URL + "/sds-search"
+	defer func() { BaseURL = previousBaseURL }()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(stdout, "Scraping %d pages with %s latency per round.\n", *pages, *latency)
+	// Fixed-width columns, so every round can be printed as soon as it is done
+	fmt.Fprintf(stdout, "%11s %6s %6s %8s %8s %6s %11s %10s %7s\n", "concurrency", "pages", "links", "seconds", "pages/s", "MB/s", "utilization", "goroutines", "heap MB")
+	for _, concurrency := range levels {
+		result, err := runBenchmarkRound(ctx, server, filepath.Join(outputDir, strconv.Itoa(concurrency)), concurrency, *pages)
+		if err != nil {
+			slog.Error("Benchmark round failed", "concurrency", concurrency, "error", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%11d %6d %6d %8.2f %8.1f %6.2f %10.0f%% %10d %7.1f\n",
+			result.Concurrency, result.Pages, result.Links, result.Duration.Seconds(), result.pagesPerSecond(),
+			result.megabytesPerSecond(), 100*result.utilization(), result.PeakGoroutines, float64(result.PeakHeapBytes)/1e6)
+	}
+	fmt.Fprintln(stdout, "goroutines and heap MB are the peaks sampled during each round.")
+	return 0
+}
+
+// parseConcurrencyLevels parses the comma-separated --concurrency levels of the benchmark.
+func parseConcurrencyLevels(value string) ([]int, error) {
+	var levels []int
+	for _, text := range splitCommaList(value) {
+		level, err := strconv.Atoi(text)
+		if err != nil || level < 1 || level > 100 {
+			return nil, fmt.Errorf("invalid concurrency level %q (expected 1 to 100)", text)
+		}
+		levels = append(levels, level)
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("no concurrency levels given")
+	}
+	return levels, nil
+}
+
+// runBenchmarkRound scrapes the first pages of the mock server into outputDir with the
+// given number of concurrent requests and extracts the links, sampling the requests in
+// flight, the goroutines and the heap while it runs. The scrape log is silenced.
+func runBenchmarkRound(ctx context.Context, server *benchmarkServer, outputDir string, concurrency int, pages int) (benchmarkResult, error) {
+	result := benchmarkResult{Concurrency: concurrency}
+	if err := ensureDir(0755, outputDir); err != nil {
+		return result, err
+	}
+	// Start every round from the same heap and with a fresh connection pool
+	runtime.GC()
+	client := newHTTPClient(htmlRequestTimeout)
+	defer client.CloseIdleConnections()
+	stats := &Statistics{}
+	bytesBefore := server.bytes.Load()
+	previousLogOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(previousLogOutput)
+
+	// Sample the load until the round is done
+	done := make(chan struct{})
+	var samplerGroup sync.WaitGroup
+	var inFlightSum, samples int64
+	samplerGroup.Add(1)
+	go func() {
+		defer samplerGroup.Done()
+		ticker := time.NewTicker(benchmarkSampleInterval)
+		defer ticker.Stop()
+		var memStats runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			inFlightSum += server.inFlight.Load()
+			samples++
+			result.PeakGoroutines = max(result.PeakGoroutines, runtime.NumGoroutine())
+			runtime.ReadMemStats(&memStats)
+			result.PeakHeapBytes = max(result.PeakHeapBytes, memStats.HeapInuse)
+		}
+	}()
+
+	startTime := time.Now()
+	outputFile := filepath.Join(outputDir, "ecolab-com.html")
+	pageErrors, err := scrapeContentAndSaveToFile(ctx, outputFile, ScrapeOptions{
+		Country:   "United States",
+		Semaphore: make(chan struct{}, concurrency),
+		Client:    client,
+		EndPage:   pages,
+		Force:     true,
+		Stats:     stats,
+	})
+	var links []SDSLink
+	if err == nil && len(pageErrors) > 0 {
+		err = &pageErrors[0]
+	}
+	if err == nil {
+		links, err = extractDownloadLinksFromFile(outputFile, nil, defaultStripParams)
+	}
+	result.Duration = time.Since(startTime)
+	close(done)
+	samplerGroup.Wait()
+	if err != nil {
+		return result, err
+	}
+	result.Pages = stats.PagesScraped.Load()
+	result.Links = len(links)
+	result.Bytes = server.bytes.Load() - bytesBefore
+	if samples > 0 {
+		result.AvgInFlight = float64(inFlightSum) / float64(samples)
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"      // Printing the lookup results
+	"io"       // Output of the lookup
+	"log/slog" // Logging the filter result
+	"strings"  // Prefix matching
+)
+
+// casFamily names the chemical family of the CAS numbers starting with Prefix.
+type casFamily struct {
+	Prefix string // CAS number prefix without hyphens
+	Name   string // Chemical family
+}
+
+// casFamilies are the chemical families of the active ingredients common in Ecolab SDS
+// sheets. CAS numbers are assigned in registration order, so a prefix only identifies a
+// family for the ranges registered together, e.g. the quaternary ammonium compounds of
+// the 684xx series.
+var casFamilies = []casFamily{
+	{Prefix: "68424", Name: "Quaternary ammonium compounds, benzyl-C8-18-alkyldimethyl chlorides"},
+	{Prefix: "68391", Name: "Quaternary ammonium compounds, benzyl-C12-18-alkyldimethyl chlorides"},
+	{Prefix: "63449", Name: "Quaternary ammonium compounds, benzalkonium chlorides"},
+	{Prefix: "8001545", Name: "Quaternary ammonium compounds, benzalkonium chloride"},
+	{Prefix: "7173515", Name: "Quaternary ammonium compounds, didecyldimethylammonium chloride"},
+	{Prefix: "7722841", Name: "Peroxides, hydrogen peroxide"},
+	{Prefix: "79210", Name: "Peroxy acids, peracetic acid"},
+	{Prefix: "7681529", Name: "Hypochlorites, sodium hypochlorite"},
+	{Prefix: "1310732", Name: "Alkali hydroxides, sodium hydroxide"},
+	{Prefix: "1310583", Name: "Alkali hydroxides, potassium hydroxide"},
+	{Prefix: "64175", Name: "Alcohols, ethanol"},
+	{Prefix: "67630", Name: "Alcohols, isopropanol"},
+	{Prefix: "64197", Name: "Carboxylic acids, acetic acid"},
+	{Prefix: "77929", Name: "Carboxylic acids, citric acid"},
+	{Prefix: "7664382", Name: "Inorganic acids, phosphoric acid"},
+}
+
+// normalizeCASNumber drops the hyphens and spaces of a CAS number, so "7173-51-5"
+// and "7173515" compare equal.
+func normalizeCASNumber(casNumber string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(casNumber))
+}
+
+// matchesCASPrefix reports whether any CAS number printed on a card starts with one of the
+// normalized prefixes; cards of mixtures list several numbers separated by commas or slashes.
+func matchesCASPrefix(casNumbers string, prefixes []string) bool {
+	for _, casNumber := range strings.FieldsFunc(casNumbers, func(r rune) bool { return r == ',' || r == ';' || r == '/' }) {
+		casNumber = normalizeCASNumber(casNumber)
+		for _, prefix := range prefixes {
+			if casNumber != "" && strings.HasPrefix(casNumber, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseCASPrefixes splits a comma-separated --filter-cas-prefix value into normalized prefixes.
+func parseCASPrefixes(value string) []string {
+	var prefixes []string
+	for _, prefix := range splitCommaList(value) {
+		if prefix = normalizeCASNumber(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// filterLinksByCASPrefix keeps only the links with a CAS number starting with one of the
+// normalized prefixes and logs how many were skipped. No prefixes keep every link.
+func filterLinksByCASPrefix(links []SDSLink, prefixes []string) []SDSLink {
+	if len(prefixes) == 0 {
+		return links // No filter requested
+	}
+	var filtered []SDSLink
+	for _, link := range links {
+		if matchesCASPrefix(link.CASNumber, prefixes) {
+			filtered = append(filtered, link)
+		}
+	}
+	slog.Info("CAS prefix filter applied", "kept", len(filtered), "skipped", len(links)-len(filtered), "total", len(links))
+	return filtered
+}
+
+// lookupCASFamilies returns the families whose prefix starts with the given prefix or is
+// a prefix of it, so both "68424" and "68424-85-1" find the benzalkonium chlorides.
+func lookupCASFamilies(prefix string) []casFamily {
+	prefix = normalizeCASNumber(prefix)
+	var families []casFamily
+	for _, family := range casFamilies {
+		if strings.HasPrefix(family.Prefix, prefix) || strings.HasPrefix(prefix, family.Prefix) {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// printCASLookup prints the families matching each comma-separated prefix for --cas-lookup
+// and returns an error when a prefix matches none.
+func printCASLookup(w io.Writer, value string) error {
+	prefixes := parseCASPrefixes(value)
+	if len(prefixes) == 0 {
+		return fmt.Errorf("--cas-lookup needs a CAS number prefix")
+	}
+	unknown := 0
+	for _, prefix := range prefixes {
+		families := lookupCASFamilies(prefix)
+		if len(families) == 0 {
+			fmt.Fprintf(w, "%s\tunknown chemical family\n", prefix)
+			unknown++
+			continue
+		}
+		for _, family := range families {
+			fmt.Fprintf(w, "%s\t%s\n", family.Prefix, family.Name)
+		}
+	}
+	if unknown > 0 {
+		return exitCode(1)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"         // Decompressing in memory
+	"compress/gzip" // Compressed scrape output
+	"errors"        // Invalid encoding error
+	"fmt"           // Error formatting
+	"io"            // Reading the decompressed content
+	"os"            // Reading the file
+	"regexp"        // Finding the <meta charset> tag
+	"strings"       // Charset name normalization
+	"unicode/utf8"  // Validating scraped pages
+
+	"golang.org/x/text/encoding"         // Decoder type
+	"golang.org/x/text/encoding/charmap" // Single-byte charsets such as latin-1 and windows-1252
+)
+
+// charsetSniffLength is how many bytes are searched for a <meta charset> tag, like browsers do.
+const charsetSniffLength = 1024
+
+// metaCharsetPattern matches both <meta charset="..."> and
+// <meta http-equiv="Content-Type" content="text/html; charset=...">.
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([a-z0-9_.:-]+)`)
+
+// charsetAliases maps common labels to the charmap names normalized by normalizeCharsetName.
+var charsetAliases = map[string]string{
+	"latin1": "iso88591",
+	"l1":     "iso88591",
+	"cp1252": "windows1252",
+	"latin9": "iso885915",
+}
+
+// normalizeCharsetName lowercases a charset name and drops separators, so "ISO-8859-1",
+// "iso_8859-1" and charmap's "ISO 8859-1" compare equal.
+func normalizeCharsetName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("-", "", "_", "", " ", "", ".", "", ":", "").Replace(name)
+	if alias, found := charsetAliases[name]; found {
+		return alias
+	}
+	return name
+}
+
+// detectCharset returns the charset declared by the first <meta charset> tag in the first
+// charsetSniffLength bytes of content ("" if none is declared).
+func detectCharset(content []byte) string {
+	match := metaCharsetPattern.FindSubmatch(content[:min(len(content), charsetSniffLength)])
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// charsetDecoder returns the decoder transcoding charset to UTF-8, or nil when the content
+// is UTF-8 already (or ASCII, a subset of it).
+func charsetDecoder(charset string) (*encoding.Decoder, error) {
+	name := normalizeCharsetName(charset)
+	if name == "" || name == "utf8" || name == "usascii" || name == "ascii" {
+		return nil, nil
+	}
+	for _, candidate := range charmap.All {
+		if cm, ok := candidate.(*charmap.Charmap); ok && normalizeCharsetName(cm.String()) == name {
+			return cm.NewDecoder(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+// readFileWithEncoding reads a file, decompressing gzip files transparently, and transcodes
+// it from charset to UTF-8. With charset "" the charset of the <meta charset> tag is used,
+// falling back to UTF-8 when the file declares none.
+func readFileWithEncoding(path, charset string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Files written with --compress start with the gzip magic bytes
+	if bytes.HasPrefix(content, gzipMagic) {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return "", fmt.Errorf("error decompressing %s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		if content, err = io.ReadAll(gzipReader); err != nil {
+			return string(content), fmt.Errorf("error decompressing %s: %w", path, err)
+		}
+	}
+	if charset == "" {
+		charset = detectCharset(content)
+	}
+	decoder, err := charsetDecoder(charset)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if decoder == nil {
+		return string(content), nil // UTF-8 already
+	}
+	decoded, err := decoder.Bytes(content)
+	if err != nil {
+		return "", fmt.Errorf("error transcoding %s from %s: %w", path, charset, err)
+	}
+	return string(decoded), nil
+}
+
+// errInvalidEncoding reports a scraped page that is neither UTF-8 nor ISO-8859-1.
+var errInvalidEncoding = errors.New("page is neither valid UTF-8 nor ISO-8859-1")
+
+// ensureUTF8 returns a scraped page as valid UTF-8. Pages declaring another charset in
+// their <meta charset> tag are returned unchanged, they are transcoded when the links are
+// extracted. Other pages with invalid UTF-8, e.g. mixed encodings or truncated multibyte
+// sequences, are decoded as ISO-8859-1, which transcoded reports.
+func ensureUTF8(page string) (utf8Page string, transcoded bool, err error) {
+	if decoder, err := charsetDecoder(detectCharset([]byte(page))); decoder != nil || err != nil {
+		return page, false, nil // Declared charset, decoded when reading the output file
+	}
+	if utf8.ValidString(page) {
+		return page, false, nil
+	}
+	decoded, err := charmap.ISO8859_1.NewDecoder().String(page)
+	if err != nil || !utf8.ValidString(decoded) {
+		return page, false, errInvalidEncoding
+	}
+	return decoded, true, nil
+}
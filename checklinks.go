@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"   // Cancellation of the checks
+	"flag"      // Command line flag parsing
+	"fmt"       // Printing the report
+	"io"        // Report output
+	"log"       // Logging errors
+	"net/http"  // HEAD requests
+	"os"        // Interrupt signal
+	"os/signal" // Interrupt handling
+	"strings"   // Building the dead links file
+	"sync"      // Waiting for the checks
+	"syscall"   // Termination signal
+)
+
+// deadLinksFileName is the file listing the dead links found by check-links, one URL per line.
+const deadLinksFileName = "dead-links.txt"
+
+// linkCheck is the outcome of the HEAD request sent to one manifest URL.
+type linkCheck struct {
+	URL        string // URL checked
+	StatusCode int    // Status of the answer (0 = no answer)
+	Err        error  // Why the request failed, if it did
+}
+
+// dead reports whether the link is gone: 404 Not Found, 410 Gone or no connection at all.
+func (check linkCheck) dead() bool {
+	return check.Err != nil || check.StatusCode == http.StatusNotFound || check.StatusCode == http.StatusGone
+}
+
+// runCheckLinks implements the "check-links" subcommand: it sends a HEAD request to every
+// URL in the manifest, with the scraper's concurrency limit and 429 handling, and writes
+// the dead ones to dead-links.txt for "purge --dead-links".
+// It returns the process exit code (1 if any dead link was found).
+func runCheckLinks(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check-links", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	manifestPath := flags.String("manifest", "manifest.json", "manifest whose URLs are checked")
+	outputPath := flags.String("output", deadLinksFileName, "file receiving the dead links, one URL per line")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+
+	// Load the manifest written by the download run
+	manifest, err := loadManifest(*manifestPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	checks := checkLinks(ctx, newHTTPClient(htmlRequestTimeout), manifest.Entries)
+	if ctx.Err() != nil {
+		log.Println("Link check interrupted, no dead links written.")
+		return 1
+	}
+
+	// Report the dead links and the ones that could not be judged
+	var deadLinks strings.Builder
+	dead := 0
+	for _, check := range checks {
+		switch {
+		case check.Err != nil:
+			fmt.Fprintf(stdout, "DEAD     %s (%v)\n", check.URL, check.Err)
+		case check.dead():
+			fmt.Fprintf(stdout, "DEAD     %s (%d %s)\n", check.URL, check.StatusCode, http.StatusText(check.StatusCode))
+		case check.StatusCode != http.StatusOK:
+			fmt.Fprintf(stdout, "UNKNOWN  %s (%d %s)\n", check.URL, check.StatusCode, http.StatusText(check.StatusCode))
+			continue
+		default:
+			continue
+		}
+		deadLinks.WriteString(check.URL + "\n")
+		dead++
+	}
+	if err := os.WriteFile(*outputPath, []byte(deadLinks.String()), 0644); err != nil {
+		log.Println("Error writing dead links:", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Checked %d links: %d dead, written to %s.\n", len(checks), dead, *outputPath)
+	if dead == 0 {
+		return 0
+	}
+	fmt.Fprintf(stdout, "Run \"purge --dead-links %s --new %s\" to move their files to the trash.\n", *outputPath, *manifestPath)
+	return 1
+}
+
+// checkLinks sends a HEAD request to the URL of every entry concurrently and returns
+// the results in the order of the entries.
+func checkLinks(ctx context.Context, client *http.Client, entries []ManifestEntry) []linkCheck {
+	checks := make([]linkCheck, len(entries))
+	// Share the scraper's limit of concurrent requests
+	concurrencySemaphore := make(chan struct{}, maxConcurrentRequests)
+	var waitGroup sync.WaitGroup
+	for index, entry := range entries {
+		checks[index].URL = entry.URL
+		select {
+		case concurrencySemaphore <- struct{}{}:
+		case <-ctx.Done():
+			checks[index].Err = ctx.Err()
+			continue
+		}
+		waitGroup.Add(1)
+		go func(check *linkCheck) {
+			defer waitGroup.Done()
+			defer func() { <-concurrencySemaphore }()
+			check.StatusCode, check.Err = headStatus(ctx, client, check.URL)
+		}(&checks[index])
+	}
+	waitGroup.Wait()
+	return checks
+}
+
+// headStatus sends a HEAD request, retrying while rate limited, and returns the status code.
+func headStatus(ctx context.Context, client *http.Client, linkURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", linkURL, nil) // Create the HEAD request
+	if err != nil {
+		return 0, fmt.Errorf("error creating HEAD request for %s: %w", linkURL, err)
+	}
+	req.Header.Set("User-Agent", defaultUserAgent) // Same identity as the scraper
+	resp, err := doWithRateLimitRetries(ctx, client, req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close() // A HEAD response has no body to read
+	return resp.StatusCode, nil
+}
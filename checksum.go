@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/md5"    // MD5, matching the ETag of single-part S3 uploads
+	"crypto/sha1"   // SHA-1
+	"crypto/sha256" // SHA-256, the default
+	"crypto/sha512" // SHA-512, for FIPS compliance
+	"encoding/hex"  // Hex encoding of the digests
+	"fmt"           // Error formatting
+	"hash"          // Hash interface
+	"maps"          // Listing the algorithms
+	"slices"        // Listing the algorithms
+	"strings"       // Algorithm name normalization
+)
+
+// defaultChecksumAlgo is the checksum algorithm of the manifest unless --checksum-algo selects another.
+const defaultChecksumAlgo = "sha256"
+
+// checksumAlgos are the hash functions selectable with --checksum-algo.
+var checksumAlgos = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Checksum is the digest of a downloaded file and the algorithm that computed it.
+type Checksum struct {
+	Algo string `json:"algo"` // Name of the hash function, e.g. "sha256"
+	Hash string `json:"hash"` // Hex encoded digest
+}
+
+// String renders the checksum as algo:hash.
+func (checksum Checksum) String() string {
+	return checksum.Algo + ":" + checksum.Hash
+}
+
+// matches reports whether both checksums were computed with the same algorithm and
+// have the same digest. Checksums of different algorithms never match.
+func (checksum Checksum) matches(other Checksum) bool {
+	return checksum.Algo == other.Algo && checksum.Hash == other.Hash
+}
+
+// sha256 returns the digest if it is a SHA-256, for the outputs with a sha256 column,
+// and "" for the other algorithms.
+func (checksum Checksum) sha256() string {
+	if checksum.Algo != "sha256" {
+		return ""
+	}
+	return checksum.Hash
+}
+
+// normalizeChecksumAlgo lowercases an algorithm name and drops its hyphen, so "SHA-256"
+// selects sha256. An empty name selects defaultChecksumAlgo.
+func normalizeChecksumAlgo(algo string) string {
+	algo = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(algo)), "-", "")
+	if algo == "" {
+		return defaultChecksumAlgo
+	}
+	return algo
+}
+
+// newChecksumHash returns a new hash of the algorithm, see checksumAlgos.
+func newChecksumHash(algo string) (hash.Hash, error) {
+	newHash, found := checksumAlgos[normalizeChecksumAlgo(algo)]
+	if !found {
+		return nil, fmt.Errorf("unknown checksum algorithm %q (expected %s)", algo, strings.Join(slices.Sorted(maps.Keys(checksumAlgos)), ", "))
+	}
+	return newHash(), nil
+}
+
+// checksumOf returns the checksum of the data written to hasher, computed with algo.
+func checksumOf(algo string, hasher hash.Hash) Checksum {
+	return Checksum{Algo: normalizeChecksumAlgo(algo), Hash: hex.EncodeToString(hasher.Sum(nil))}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"  // Cancelling the other chunks
+	"fmt"      // Error formatting
+	"io"       // Offset writers
+	"net/http" // Range requests
+	"os"       // Output file
+	"path"     // Download folder
+	"strings"  // Header parsing
+	"sync"     // Waiting for the chunks
+	"time"     // Download duration
+)
+
+// parallelChunkThreshold is the size above which PDFs are downloaded in parallel chunks.
+const parallelChunkThreshold = 10 << 20 // 10 MB
+
+// acceptsByteRanges reports whether the headers announce support for byte Range requests.
+func acceptsByteRanges(header http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(header.Get("Accept-Ranges")), "bytes")
+}
+
+// downloadPDFInChunks downloads the size bytes of a PDF in opts.ParallelChunks Range
+// requests sent in parallel, each written by its own goroutine into its byte range of
+// the pre-allocated file. If-Range makes sure every chunk comes from the same version
+// of the PDF as the pre-flight headers. The file is deleted if any chunk fails.
+func downloadPDFInChunks(ctx context.Context, opts DownloadOptions, link SDSLink, fullPath string, size int64, header http.Header, meta pdfMetadata) (pdfMetadata, error) {
+	pdfURL := link.URL                                 // URL of the PDF
+	meta.pageValidators = validatorsFromHeader(header) // Remember the validators of the new file
+	if err := ensureDir(0755, path.Dir(fullPath)); err != nil {
+		return meta, err
+	}
+	out, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return meta, fmt.Errorf("error creating file: %w", err)
+	}
+	defer out.Close() // Ensure file is closed after writing
+	// Allocate the whole file, so every chunk can be written at its offset
+	if err := out.Truncate(size); err != nil {
+		out.Close()
+		os.Remove(fullPath)
+		return meta, fmt.Errorf("error allocating %s: %w", fullPath, err)
+	}
+
+	startTime := time.Now() // Measure the download duration
+	// Stop the other chunks as soon as one fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	var errMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	chunkSize := (size + int64(opts.ParallelChunks) - 1) / int64(opts.ParallelChunks)
+	for start := int64(0); start < size; start += chunkSize {
+		end := min(start+chunkSize, size) - 1 // Last byte of the chunk, inclusive like the Range header
+		waitGroup.Add(1)
+		go func(start, end int64) {
+			defer waitGroup.Done()
+			if err := downloadChunk(ctx, opts.Client, pdfURL, link.referer(), header, io.NewOffsetWriter(out, start), start, end); err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				errMutex.Unlock()
+			}
+		}(start, end)
+	}
+	waitGroup.Wait()
+	downloadDuration := time.Since(startTime) // All chunk bodies are closed once the goroutines are done
+	if firstErr != nil {
+		out.Close()
+		os.Remove(fullPath) // Never leave a file with holes that looks complete
+		return meta, fmt.Errorf("error downloading PDF in chunks: %w", firstErr)
+	}
+	if err := out.Close(); err != nil {
+		return meta, fmt.Errorf("error saving PDF: %w", err)
+	}
+	if err := checkPDFHeader(fullPath); err != nil {
+		os.Remove(fullPath)
+		return meta, fmt.Errorf("%w: %s: %w", errInvalidPDF, pdfURL, err)
+	}
+
+	meta.DownloadDurationMS = downloadDuration.Milliseconds()
+	opts.checkSlowDownload(pdfURL, downloadDuration)
+
+	opts.Stats.PDFsDownloaded.Add(1)     // Count the completed download
+	opts.Stats.BytesDownloaded.Add(size) // Count the bytes transferred by the chunks
+	opts.logger().Info("pdf downloaded", "path", fullPath, "url", pdfURL, "bytes", size,
+		"duration_ms", meta.DownloadDurationMS, "chunks", opts.ParallelChunks)
+	return meta, nil
+}
+
+// downloadChunk downloads the bytes start to end (inclusive) of the PDF into w.
+func downloadChunk(ctx context.Context, client *http.Client, pdfURL string, referer string, header http.Header, w io.Writer, start, end int64) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", pdfURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request for %s: %w", pdfURL, err)
+	}
+	req.Header.Set("Referer", referer) // Like a click on the search page
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	// Only accept the range of the version announced by the pre-flight
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		req.Header.Set("If-Range", etag)
+	} else if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Range", lastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading bytes %d-%d: %w", start, end, asRedirectLoopError(pdfURL, err))
+	}
+	defer resp.Body.Close()
+	// A 200 means the server ignored the range, e.g. because the PDF changed meanwhile
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("status code error for bytes %d-%d: %d %s", start, end, resp.StatusCode, resp.Status)
+	}
+	length := end - start + 1
+	written, err := io.Copy(w, io.LimitReader(resp.Body, length))
+	if err != nil {
+		return fmt.Errorf("error saving bytes %d-%d: %w", start, end, err)
+	}
+	if written != length {
+		return fmt.Errorf("bytes %d-%d: received %d of %d bytes", start, end, written, length)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"             // PDF body
+	"context"           // Downloading the chunks
+	"net/http"          // Range requests
+	"net/http/httptest" // Built-in mock server
+	"os"                // Output file
+	"path/filepath"     // Output path
+	"strings"           // Error matching
+	"sync/atomic"       // Counting the requests
+	"testing"           // Test framework
+	"time"              // Modification time of the served PDF
+)
+
+// newVersionedPDFServer serves body with the ETag etag and honours Range and If-Range
+// like a CDN: a Range request whose If-Range is not the current ETag gets the whole
+// PDF with 200 OK. requests counts the requests answered.
+func newVersionedPDFServer(t *testing.T, etag string, body []byte, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/pdf")
+		http.ServeContent(w, r, "sheet.pdf", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadPDFInChunksIfRange(t *testing.T) {
+	body := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("sheet "), 1000)...)
+	tests := []struct {
+		name       string
+		preflight  string // ETag of the pre-flight headers
+		serverETag string // ETag of the PDF when the chunks are requested
+		wantErr    bool
+	}{
+		{"same version", `"v1"`, `"v1"`, false},
+		// The PDF changed between the pre-flight and the chunks, so the server answers
+		// every chunk with 200 and the whole new version
+		{"changed version", `"v1"`, `"v2"`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := newVersionedPDFServer(t, test.serverETag, body, &requests)
+			fullPath := filepath.Join(t.TempDir(), "sheet.pdf")
+			opts := DownloadOptions{Client: server.Client(), ParallelChunks: 4, Stats: &Statistics{}}
+			link := SDSLink{URL: server.URL + "/-/media/sds/sheet.pdf"}
+			header := http.Header{}
+			header.Set("ETag", test.preflight)
+			header.Set("Accept-Ranges", "bytes")
+
+			_, err := downloadPDFInChunks(context.Background(), opts, link, fullPath, int64(len(body)), header, pdfMetadata{})
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "200") {
+					t.Fatalf("downloadPDFInChunks = %v, want a status code error for the 200 answer", err)
+				}
+				// A file pieced together from the whole PDF must not be left behind
+				if _, statErr := os.Stat(fullPath); !os.IsNotExist(statErr) {
+					t.Errorf("%s exists after the failed download (%v), want it removed", fullPath, statErr)
+				}
+				if got := opts.Stats.PDFsDownloaded.Load(); got != 0 {
+					t.Errorf("PDFsDownloaded = %d, want 0", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadPDFInChunks: %v", err)
+			}
+			if got := requests.Load(); got != 4 {
+				t.Errorf("server answered %d requests, want one per chunk (4)", got)
+			}
+			content, err := os.ReadFile(fullPath)
+			if err != nil || !bytes.Equal(content, body) {
+				t.Errorf("downloaded %d bytes (%v), want the %d bytes of the PDF", len(content), err, len(body))
+			}
+			if got := opts.Stats.BytesDownloaded.Load(); got != int64(len(body)) {
+				t.Errorf("BytesDownloaded = %d, want %d", got, len(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"         // Line by line reading of the config file
+	"flag"          // Access to the registered command line flags
+	"fmt"           // Formatting for error messages
+	"os"            // File and environment access
+	"path/filepath" // Path manipulation
+	"strings"       // String manipulation
+)
+
+// configFileName is the name of the configuration file looked up in the current directory.
+const configFileName = "ecolab-scraper.yaml"
+
+// findConfigFile returns the configuration file to load: ./ecolab-scraper.yaml when it exists,
+// otherwise $XDG_CONFIG_HOME/ecolab-scraper/config.yaml (~/.config when XDG_CONFIG_HOME is unset).
+// An empty string is returned when neither exists.
+func findConfigFile() string {
+	// A config in the current directory wins over the per-user one
+	if fileExists(configFileName) {
+		return configFileName
+	}
+	// Resolve the per-user config directory following the XDG base directory spec
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	userConfig := filepath.Join(configHome, "ecolab-scraper", "config.yaml")
+	if fileExists(userConfig) {
+		return userConfig
+	}
+	return ""
+}
+
+// loadConfigFile parses a minimal YAML file made of "flag-name: value" lines.
+// Comments (#), blank lines, quoted values and flow lists ([en, fr]) are supported;
+// lists are joined with commas to match the comma-separated flags.
+func loadConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file %s: %w", path, err)
+	}
+	defer file.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := stripConfigComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue // Blank or comment-only line
+		}
+		// Split the line into the flag name and its value
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected \"name: value\"", path, lineNumber)
+		}
+		// Accept both max-pdfs and max_pdfs spellings
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		values[key] = parseConfigValue(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// stripConfigComment removes a trailing # comment that is not inside quotes.
+func stripConfigComment(line string) string {
+	var quote rune
+	for index, character := range line {
+		switch {
+		case quote != 0 && character == quote:
+			quote = 0 // Closing quote
+		case quote == 0 && (character == '"' || character == '\''):
+			quote = character // Opening quote
+		case quote == 0 && character == '#':
+			return line[:index]
+		}
+	}
+	return line
+}
+
+// parseConfigValue unquotes a scalar value and joins a flow list with commas.
+func parseConfigValue(value string) string {
+	// Turn [a, b, c] into "a,b,c"
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		var items []string
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = parseConfigValue(strings.TrimSpace(item)); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ",")
+	}
+	// Remove matching single or double quotes
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// applyConfigFile sets every flag that was not given on the command line from the config file,
+// so command line flags always override the file.
+func applyConfigFile(flags *flag.FlagSet, path string) error {
+	values, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	// Remember which flags were given explicitly on the command line
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setOnCommandLine[f.Name] = true })
+	for name, value := range values {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if setOnCommandLine[name] {
+			continue // The command line wins
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// envPrefix is the prefix of the environment variables overriding the flags.
+const envPrefix = "ECOLAB"
+
+// envVarName returns the environment variable of a flag: envPrefix, an underscore and the
+// flag name in upper case with dashes replaced by underscores, e.g. max-pdfs -> ECOLAB_MAX_PDFS.
+func envVarName(flagName string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvironment sets every flag that was not given on the command line from its
+// environment variable (see envVarName). Flags set this way count as set, so the
+// precedence is: command line, environment, configuration file, defaults.
+func applyEnvironment(flags *flag.FlagSet) error {
+	// Remember which flags were given explicitly on the command line
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setOnCommandLine[f.Name] = true })
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, found := os.LookupEnv(envVarName(f.Name))
+		if !found || setOnCommandLine[f.Name] || err != nil {
+			return // Unset, the command line wins, or an earlier variable was invalid
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", envVarName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// printEnvironmentTable writes the mapping of the flags to their environment variables.
+func printEnvironmentTable(flags *flag.FlagSet) {
+	fmt.Fprintf(flags.Output(), "\nEvery flag can also be set with an environment variable (the command line wins):\n")
+	flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(flags.Output(), "  %-32s --%s\n", envVarName(f.Name), f.Name)
+	})
+}
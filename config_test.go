@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"          // Flag set under test
+	"io"            // Discarding the usage
+	"os"            // Writing the config file
+	"path/filepath" // Config file path
+	"testing"       // Test framework
+)
+
+// TestFlagPrecedence checks that every flag takes the command line value, then the
+// environment, then the configuration file and only then its default, in the order run
+// applies them.
+func TestFlagPrecedence(t *testing.T) {
+	flags := flag.NewFlagSet("ecolab-scraper", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	country := flags.String("country", "United States", "")
+	maxPDFs := flags.Int("max-pdfs", 0, "")
+	workers := flags.Int("workers", 4, "")
+	outputDir := flags.String("output-dir", "PDFs", "")
+	// Each source sets its own flag and every flag of the lower sources
+	t.Setenv(envVarName("country"), "Germany")
+	t.Setenv(envVarName("max-pdfs"), "20")
+	configPath := filepath.Join(t.TempDir(), configFileName)
+	config := "country: France\nmax-pdfs: 30\nworkers: 8 # From the file\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := flags.Parse([]string{"--country", "Canada"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := applyEnvironment(flags); err != nil {
+		t.Fatalf("applyEnvironment: %v", err)
+	}
+	if err := applyConfigFile(flags, configPath); err != nil {
+		t.Fatalf("applyConfigFile: %v", err)
+	}
+	if *country != "Canada" {
+		t.Errorf("country = %q, want the command line value Canada", *country)
+	}
+	if *maxPDFs != 20 {
+		t.Errorf("max-pdfs = %d, want the environment value 20", *maxPDFs)
+	}
+	if *workers != 8 {
+		t.Errorf("workers = %d, want the config file value 8", *workers)
+	}
+	if *outputDir != "PDFs" {
+		t.Errorf("output-dir = %q, want the default PDFs", *outputDir)
+	}
+}
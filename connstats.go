@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"  // Dial cancellation
+	"log/slog" // Logging the connection reuse
+	"net"      // Dialing the connections
+	"net/http" // HTTP transport wrapping
+	"time"     // Dialer timeouts
+)
+
+// requestCountingTransport counts the requests sent through it in Statistics.Requests.
+type requestCountingTransport struct {
+	base  http.RoundTripper // Transport performing the actual request
+	stats *Statistics       // Counters of the current run
+}
+
+// RoundTrip counts and sends the request.
+func (transport *requestCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.stats.Requests.Add(1)
+	return transport.base.RoundTrip(req)
+}
+
+// withConnectionCounting makes client count its requests in stats.Requests and the TCP
+// connections it dials in stats.NewConnections, which shows whether keep-alive connections
+// are reused. Apply it after the TLS options and before withBasicAuth and
+// withHeaderLogging, while the transport of the client is still an *http.Transport;
+// otherwise only the requests are counted.
+func withConnectionCounting(client *http.Client, stats *Statistics) *http.Client {
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		dial := transport.DialContext
+		if dial == nil {
+			// The dialer of http.DefaultTransport
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			connection, err := dial(ctx, network, address)
+			if err == nil {
+				stats.NewConnections.Add(1)
+			}
+			return connection, err
+		}
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &requestCountingTransport{base: base, stats: stats}
+	return client
+}
+
+// logConnectionReuse logs how many requests of a phase were sent per new connection;
+// a ratio close to 1 means keep-alive connections are not reused, e.g. because
+// MaxIdleConnsPerHost is lower than the number of concurrent requests.
+func logConnectionReuse(phase string, requests int64, newConnections int64) {
+	if requests == 0 {
+		return // Nothing was sent
+	}
+	requestsPerConnection := float64(requests)
+	if newConnections > 0 {
+		requestsPerConnection /= float64(newConnections)
+	}
+	slog.Info("Connection reuse", "phase", phase, "requests", requests, "new_connections", newConnections,
+		"requests_per_connection", requestsPerConnection)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"compress/gzip" // gzip response bodies
+	"fmt"           // Error formatting
+	"io"            // Body wrapping
+	"net/http"      // Response headers
+	"strings"       // Header parsing
+
+	"github.com/andybalholm/brotli" // br response bodies
+)
+
+// acceptEncoding is sent with the page requests. Setting it explicitly turns off the
+// transport's transparent gzip handling, so decodedBody must be used on the responses.
+const acceptEncoding = "gzip, br"
+
+// decodedBody wraps the body of resp so it reads the decompressed content according to
+// the Content-Encoding header. Unknown encodings are reported as errors.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return resp.Body, nil // Not compressed
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding gzip body: %w", err)
+		}
+		return reader, nil
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the report
+	"io"            // Report output
+	"io/fs"         // Directory walking
+	"log"           // Logging errors
+	"os"            // Linking and removing files
+	"path/filepath" // Path manipulation
+	"sort"          // Choosing the file to keep
+)
+
+// runDedupe implements the "dedupe" subcommand: it hashes every file in the PDFs folder,
+// keeps the lexicographically first file of every group of identical files and replaces
+// the others with hard links to it (or deletes them with --delete). It returns the
+// process exit code.
+func runDedupe(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	outputDir := flags.String("dir", ".", "output directory holding the PDFs/ folder")
+	deleteDuplicates := flags.Bool("delete", false, "delete the duplicates instead of replacing them with hard links")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+
+	// Group the files of the PDFs folder by content
+	filesByHash := make(map[string][]string)
+	sizes := make(map[string]int64)
+	failed := 0
+	filepath.WalkDir(filepath.Join(*outputDir, "PDFs"), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && entry.Name() == trashDirName {
+			return filepath.SkipDir // Purged files are not part of the collection
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return nil // Skip unreadable entries, directories and links
+		}
+		checksum, size, err := hashFile(path, defaultChecksumAlgo)
+		if err != nil {
+			log.Println(err)
+			failed++
+			return nil
+		}
+		filesByHash[checksum.Hash] = append(filesByHash[checksum.Hash], path)
+		sizes[checksum.Hash] = size
+		return nil
+	})
+	// Keep the first file of every group and replace or delete the others
+	groups, replaced := 0, 0
+	var savedBytes int64
+	for sum, paths := range filesByHash {
+		if len(paths) < 2 {
+			continue
+		}
+		groups++
+		sort.Strings(paths)
+		keep := paths[0]
+		for _, duplicate := range paths[1:] {
+			if sameFile(keep, duplicate) {
+				continue // Already a hard link to the kept file
+			}
+			var err error
+			if *deleteDuplicates {
+				err = os.Remove(duplicate)
+			} else {
+				err = replaceWithHardLink(keep, duplicate)
+			}
+			if err != nil {
+				log.Println("Error deduplicating file:", err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(stdout, "DUPLICATE  %s = %s\n", duplicate, keep)
+			replaced++
+			savedBytes += sizes[sum]
+		}
+	}
+	action := "Linked"
+	if *deleteDuplicates {
+		action = "Deleted"
+	}
+	fmt.Fprintf(stdout, "%s %d duplicates in %d groups of identical files, saving %s.\n", action, replaced, groups, formatBytes(savedBytes))
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d files could not be processed.\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// sameFile reports whether both paths already refer to the same file on disk.
+func sameFile(path1 string, path2 string) bool {
+	info1, err1 := os.Stat(path1)
+	info2, err2 := os.Stat(path2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
+
+// replaceWithHardLink atomically replaces duplicate with a hard link to target.
+func replaceWithHardLink(target string, duplicate string) error {
+	// Create the link next to the duplicate first so it is never missing
+	tempPath := duplicate + ".link"
+	if err := os.Link(target, tempPath); err != nil {
+		return fmt.Errorf("error linking %s to %s: %w", duplicate, target, err)
+	}
+	if err := os.Rename(tempPath, duplicate); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("error replacing %s: %w", duplicate, err)
+	}
+	return nil
+}
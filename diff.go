@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json" // Machine-readable output
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the report
+	"io"            // Destination of the report
+	"log/slog"      // Logging errors
+	"slices"        // Sorting the URLs
+	"strings"       // Comparing the URLs
+)
+
+// manifestChange describes an URL listed in both manifests whose file or revision changed.
+// The SHA-256 keys of the JSON output predate --checksum-algo and are kept for existing
+// consumers; they are empty for the other algorithms.
+type manifestChange struct {
+	URL             string   `json:"url"`
+	OldSHA256       string   `json:"old_sha256"`
+	NewSHA256       string   `json:"new_sha256"`
+	OldChecksum     Checksum `json:"old_checksum"`
+	NewChecksum     Checksum `json:"new_checksum"`
+	OldRevisionDate string   `json:"old_revision_date,omitempty"`
+	NewRevisionDate string   `json:"new_revision_date,omitempty"`
+}
+
+// manifestDiff lists what changed between two manifests, every list sorted by URL.
+type manifestDiff struct {
+	Added   []string         `json:"added"`   // URLs only in the new manifest
+	Removed []string         `json:"removed"` // URLs only in the old manifest
+	Changed []manifestChange `json:"changed"` // URLs whose checksum or revision_date changed
+}
+
+// runDiff implements the "diff" subcommand: it compares two manifests, e.g. of two daily
+// runs, and prints the added, removed and changed URLs.
+// It returns the process exit code.
+func runDiff(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	oldPath := flags.String("old", "", "manifest of the previous run (required)")
+	newPath := flags.String("new", "manifest.json", "manifest of the current run")
+	format := flags.String("format", "text", "output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+	if *oldPath == "" {
+		slog.Error("diff: --old is required")
+		flags.Usage()
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		slog.Error("diff: unknown format (expected text or json)", "format", *format)
+		return 2
+	}
+
+	// Load both manifests
+	oldManifest, err := loadManifest(*oldPath)
+	if err != nil {
+		slog.Error("Error loading manifest", "path", *oldPath, "error", err)
+		return 1
+	}
+	newManifest, err := loadManifest(*newPath)
+	if err != nil {
+		slog.Error("Error loading manifest", "path", *newPath, "error", err)
+		return 1
+	}
+	diff := diffManifests(oldManifest, newManifest)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			slog.Error("Error writing diff", "error", err)
+			return 1
+		}
+		return 0
+	}
+	printManifestDiff(stdout, diff)
+	return 0
+}
+
+// printManifestDiff writes the text report of diff to w: one line per added, removed and
+// changed URL, then the totals.
+func printManifestDiff(w io.Writer, diff manifestDiff) {
+	for _, url := range diff.Added {
+		fmt.Fprintf(w, "ADDED    %s\n", url)
+	}
+	for _, url := range diff.Removed {
+		fmt.Fprintf(w, "REMOVED  %s\n", url)
+	}
+	for _, change := range diff.Changed {
+		fmt.Fprintf(w, "CHANGED  %s", change.URL)
+		if !change.OldChecksum.matches(change.NewChecksum) {
+			fmt.Fprintf(w, " (checksum %s:%s -> %s:%s)", change.OldChecksum.Algo, shortChecksum(change.OldChecksum.Hash), change.NewChecksum.Algo, shortChecksum(change.NewChecksum.Hash))
+		}
+		if change.OldRevisionDate != change.NewRevisionDate {
+			fmt.Fprintf(w, " (revision %q -> %q)", change.OldRevisionDate, change.NewRevisionDate)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d changed.\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+// diffManifests compares the entries of two manifests by URL.
+func diffManifests(oldManifest, newManifest *Manifest) manifestDiff {
+	// Empty lists rather than null in the JSON output
+	diff := manifestDiff{Added: []string{}, Removed: []string{}, Changed: []manifestChange{}}
+	oldEntries := make(map[string]ManifestEntry)
+	for _, entry := range oldManifest.Entries {
+		oldEntries[entry.URL] = entry
+	}
+	newURLs := make(map[string]bool)
+	for _, entry := range newManifest.Entries {
+		newURLs[entry.URL] = true
+		previous, found := oldEntries[entry.URL]
+		switch {
+		case !found:
+			diff.Added = append(diff.Added, entry.URL)
+		case !previous.Checksum.matches(entry.Checksum) || previous.RevisionDate != entry.RevisionDate:
+			diff.Changed = append(diff.Changed, manifestChange{
+				URL:             entry.URL,
+				OldSHA256:       previous.Checksum.sha256(),
+				NewSHA256:       entry.Checksum.sha256(),
+				OldChecksum:     previous.Checksum,
+				NewChecksum:     entry.Checksum,
+				OldRevisionDate: previous.RevisionDate,
+				NewRevisionDate: entry.RevisionDate,
+			})
+		}
+	}
+	for url := range oldEntries {
+		if !newURLs[url] {
+			diff.Removed = append(diff.Removed, url)
+		}
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.SortFunc(diff.Changed, func(a, b manifestChange) int { return strings.Compare(a.URL, b.URL) })
+	return diff
+}
+
+// shortChecksum abbreviates a hex checksum for the text output, like git abbreviates hashes.
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json" // Decoding the JSON output
+	"testing"       // Test framework
+)
+
+func TestDiffManifestsJSONKeys(t *testing.T) {
+	oldManifest := &Manifest{Entries: []ManifestEntry{
+		{SDSLink: SDSLink{URL: "https://x.com/a.pdf"}, Checksum: Checksum{Algo: "sha256", Hash: "aaa"}},
+		{SDSLink: SDSLink{URL: "https://x.com/b.pdf"}, Checksum: Checksum{Algo: "sha256", Hash: "bbb"}},
+	}}
+	newManifest := &Manifest{Entries: []ManifestEntry{
+		{SDSLink: SDSLink{URL: "https://x.com/a.pdf"}, Checksum: Checksum{Algo: "sha256", Hash: "ccc"}},
+		{SDSLink: SDSLink{URL: "https://x.com/b.pdf"}, Checksum: Checksum{Algo: "md5", Hash: "ddd"}},
+	}}
+	content, err := json.Marshal(diffManifests(oldManifest, newManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff struct {
+		Changed []map[string]any `json:"changed"`
+	}
+	if err := json.Unmarshal(content, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changed) != 2 {
+		t.Fatalf("changed = %v, want 2 entries", diff.Changed)
+	}
+	// The keys of the JSON output before --checksum-algo stay, filled for SHA-256 only
+	want := []map[string]any{
+		{"old_sha256": "aaa", "new_sha256": "ccc"},
+		{"old_sha256": "bbb", "new_sha256": ""},
+	}
+	for index, change := range diff.Changed {
+		for key, value := range want[index] {
+			if change[key] != value {
+				t.Errorf("%s: %s = %v, want %q", change["url"], key, change[key], value)
+			}
+		}
+		for _, key := range []string{"old_checksum", "new_checksum"} {
+			if _, found := change[key]; !found {
+				t.Errorf("%s: %s missing", change["url"], key)
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+
+package main
+
+import "syscall" // Filesystem statistics
+
+// diskFreeBytes returns the space available to unprivileged users on the filesystem holding dir.
+func diskFreeBytes(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	// Available blocks for unprivileged users times the block size
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"   // Error inspection
+	"fmt"      // Error messages
+	"net/http" // Status codes
+	"strings"  // Matching redirect errors
+)
+
+// FetchError reports a search page that could not be fetched.
+type FetchError struct {
+	URL        string // URL of the page
+	StatusCode int    // HTTP status code of the answer (0 when no answer was received)
+	Body       string // Start of the body of the last answer, for 503 Service Unavailable after all retries
+	Err        error  // Underlying error (nil for an unexpected status code)
+}
+
+func (err *FetchError) Error() string {
+	if err.Err == nil && err.Body != "" {
+		return fmt.Sprintf("unexpected status code %d for %s: %s", err.StatusCode, err.URL, err.Body)
+	}
+	if err.Err == nil {
+		return fmt.Sprintf("unexpected status code %d for %s", err.StatusCode, err.URL)
+	}
+	return fmt.Sprintf("failed to GET %s: %v", err.URL, err.Err)
+}
+
+func (err *FetchError) Unwrap() error {
+	return err.Err
+}
+
+// PageError reports a search result page that could not be scraped, after all attempts.
+type PageError struct {
+	Page   int    // One-based number of the page
+	Offset int    // Offset of the first document on the page
+	URL    string // URL of the page
+	Err    error  // Error of the last attempt
+}
+
+func (err *PageError) Error() string {
+	return fmt.Sprintf("failed to scrape page %d (offset %d): %v", err.Page, err.Offset, err.Err)
+}
+
+func (err *PageError) Unwrap() error {
+	return err.Err
+}
+
+// ParseError reports a scraped page whose links could not be extracted.
+type ParseError struct {
+	Offset int   // Byte offset of the page in the scraped HTML file
+	Err    error // Underlying error
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse page at byte %d: %v", err.Offset, err.Err)
+}
+
+func (err *ParseError) Unwrap() error {
+	return err.Err
+}
+
+// DownloadError reports a PDF that could not be downloaded.
+type DownloadError struct {
+	PDFURL string // URL of the PDF
+	Err    error  // Underlying error
+}
+
+func (err *DownloadError) Error() string {
+	return fmt.Sprintf("failed to download %s: %v", err.PDFURL, err.Err)
+}
+
+func (err *DownloadError) Unwrap() error {
+	return err.Err
+}
+
+// RedirectLoopError reports a PDF whose redirects never led to a file, e.g. a CDN
+// redirecting back and forth between two URLs until http.Client gives up.
+type RedirectLoopError struct {
+	URL string // URL of the PDF
+	Err error  // Error returned by http.Client
+}
+
+func (err *RedirectLoopError) Error() string {
+	return fmt.Sprintf("redirect loop for %s: %v", err.URL, err.Err)
+}
+
+func (err *RedirectLoopError) Unwrap() error {
+	return err.Err
+}
+
+// redirectLimitMessage is part of the error of http.Client's default redirect policy
+// once it stopped following redirects; the error has no type to match instead.
+const redirectLimitMessage = "stopped after 10 redirects"
+
+// asRedirectLoopError returns a *RedirectLoopError for an error caused by too many
+// redirects and err unchanged otherwise.
+func asRedirectLoopError(url string, err error) error {
+	if err != nil && strings.Contains(err.Error(), redirectLimitMessage) {
+		return &RedirectLoopError{URL: url, Err: err}
+	}
+	return err
+}
+
+// isRetryable reports whether fetching a page again may succeed: network errors, rate
+// limiting and server errors are temporary, other answers such as 404 are not.
+func isRetryable(err error) bool {
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		return true // Not a fetch failure; assume it may go away
+	}
+	return fetchErr.StatusCode == 0 || fetchErr.StatusCode == http.StatusTooManyRequests || fetchErr.StatusCode >= 500
+}
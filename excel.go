@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"           // Error formatting
+	"os"            // Writing the workbook
+	"path/filepath" // File names of the PDFs
+	"unicode/utf8"  // Column widths
+
+	"github.com/xuri/excelize/v2" // Excel workbooks
+)
+
+// excelFileName is the workbook written next to manifest.json with --output-format excel.
+const excelFileName = "manifest.xlsx"
+
+// excelSheetName is the sheet of the workbook listing the SDS sheets.
+const excelSheetName = "SDS Index"
+
+// excelHeader is the header row of the SDS Index sheet.
+var excelHeader = []string{"Product Name", "CAS Number", "Language", "Revision Date", "PDF Filename", "Download URL"}
+
+// excelMaxColumnWidth keeps long URLs from making a column wider than the screen.
+const excelMaxColumnWidth = 80
+
+// newExcelRows describes every link as a row of the SDS Index sheet, with the file name
+// of the PDF when the manifest records its download.
+func newExcelRows(links []SDSLink, manifest *Manifest) [][]string {
+	rows := make([][]string, 0, len(links))
+	for _, link := range links {
+		fileName := ""
+		if entry := manifest.find(link.URL); entry != nil && entry.FilePath != "" {
+			fileName = filepath.Base(entry.FilePath)
+		}
+		rows = append(rows, []string{link.ProductName, link.CASNumber, link.Language, link.RevisionDate, fileName, link.URL})
+	}
+	return rows
+}
+
+// writeExcel writes the links and their downloads as the SDS Index sheet of the workbook
+// at path: a bold header row with filter dropdowns and columns sized to their content.
+// The previous version is replaced atomically.
+func writeExcel(path string, links []SDSLink, manifest *Manifest) error {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+	if err := workbook.SetSheetName("Sheet1", excelSheetName); err != nil {
+		return fmt.Errorf("error creating sheet: %w", err)
+	}
+	rows := append([][]string{excelHeader}, newExcelRows(links, manifest)...)
+	widths := make([]int, len(excelHeader)) // Longest value of every column, in characters
+	for index, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, index+1) // Valid, the coordinates are positive
+		if err := workbook.SetSheetRow(excelSheetName, cell, &row); err != nil {
+			return fmt.Errorf("error writing row %d: %w", index+1, err)
+		}
+		for column, value := range row {
+			widths[column] = max(widths[column], utf8.RuneCountInString(value))
+		}
+	}
+	// Excel has no auto-size on open, so size the columns to their longest value
+	for column, width := range widths {
+		name, _ := excelize.ColumnNumberToName(column + 1) // Valid, the column numbers are positive
+		if err := workbook.SetColWidth(excelSheetName, name, name, float64(min(width+2, excelMaxColumnWidth))); err != nil {
+			return fmt.Errorf("error sizing column %s: %w", name, err)
+		}
+	}
+	// Bold header row with filter dropdowns over all rows
+	bold, err := workbook.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("error creating header style: %w", err)
+	}
+	lastHeaderCell, _ := excelize.CoordinatesToCellName(len(excelHeader), 1)
+	if err := workbook.SetCellStyle(excelSheetName, "A1", lastHeaderCell, bold); err != nil {
+		return fmt.Errorf("error styling header: %w", err)
+	}
+	lastCell, _ := excelize.CoordinatesToCellName(len(excelHeader), len(rows))
+	if err := workbook.AutoFilter(excelSheetName, "A1:"+lastCell, nil); err != nil {
+		return fmt.Errorf("error adding filter: %w", err)
+	}
+	// Write to a temporary file first so readers never see a truncated workbook
+	temporaryPath := path + ".tmp"
+	file, err := os.Create(temporaryPath)
+	if err != nil {
+		return fmt.Errorf("error creating workbook %s: %w", temporaryPath, err)
+	}
+	if err := workbook.Write(file); err != nil {
+		file.Close()
+		os.Remove(temporaryPath)
+		return fmt.Errorf("error writing workbook %s: %w", temporaryPath, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(temporaryPath)
+		return fmt.Errorf("error closing workbook %s: %w", temporaryPath, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf("error replacing workbook %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json" // Health report
+	"errors"        // Error inspection
+	"fmt"           // Error formatting
+	"log/slog"      // Logging server errors
+	"net/http"      // Health HTTP server
+	"runtime"       // Goroutine count
+	"strings"       // Splitting the address
+)
+
+// defaultHealthPath is served when --health-check-url has no path, e.g. ":9090".
+const defaultHealthPath = "/health"
+
+// healthReport is the JSON body of the health endpoint.
+type healthReport struct {
+	Status       string  `json:"status"`         // "ok" or "unhealthy"
+	Phase        string  `json:"phase"`          // "idle", "scrape" or "download"
+	Goroutines   int     `json:"goroutines"`     // Goroutines of the process
+	Errors       int64   `json:"errors"`         // Failed page fetches and PDF downloads of the run
+	ErrorRate    float64 `json:"error_rate"`     // Share of the attempts of the run that failed
+	MaxErrorRate float64 `json:"max_error_rate"` // Error rate above which the process is unhealthy
+}
+
+// splitHealthCheckURL splits a --health-check-url value such as ":9090/health" into the
+// listen address and the path of the endpoint.
+func splitHealthCheckURL(value string) (addr string, healthPath string, err error) {
+	addr, healthPath, found := strings.Cut(value, "/")
+	if addr == "" {
+		return "", "", fmt.Errorf("invalid --health-check-url %q: expected an address such as :9090/health", value)
+	}
+	if !found || healthPath == "" {
+		return addr, defaultHealthPath, nil
+	}
+	return addr, "/" + healthPath, nil
+}
+
+// healthHandler answers 200 while the error rate of the run is at most maxErrorRate and
+// 503 above it, with a healthReport in both cases.
+func healthHandler(stats *Statistics, maxErrorRate float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{
+			Status:       "ok",
+			Phase:        stats.currentPhase(),
+			Goroutines:   runtime.NumGoroutine(),
+			Errors:       stats.Errors.Load(),
+			ErrorRate:    stats.errorRate(),
+			MaxErrorRate: maxErrorRate,
+		}
+		statusCode := http.StatusOK
+		if report.ErrorRate > maxErrorRate {
+			report.Status = "unhealthy"
+			statusCode = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(report) // The prober only needs the status code if this fails
+	}
+}
+
+// startHealthServer serves the liveness endpoint described by value (e.g. ":9090/health")
+// in the background and returns the server so it can be shut down.
+func startHealthServer(value string, stats *Statistics, maxErrorRate float64) (*http.Server, error) {
+	addr, healthPath, err := splitHealthCheckURL(value)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthPath, healthHandler(stats, maxErrorRate))
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error serving health checks", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("Serving health checks", "addr", addr, "path", healthPath)
+	return server, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog" // Debug logging
+	"net/http" // HTTP transport wrapping
+)
+
+// headerLoggingTransport logs the headers of every request and response at debug level.
+type headerLoggingTransport struct {
+	base http.RoundTripper // Transport performing the actual request
+}
+
+// RoundTrip sends the request and logs both header sets.
+func (transport *headerLoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slog.Debug("http request", "method", req.Method, "url", req.URL.String(), "headers", req.Header)
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("http response", "url", req.URL.String(), "status", resp.StatusCode, "headers", resp.Header)
+	return resp, nil
+}
+
+// withHeaderLogging makes client log the headers of its requests and responses.
+// Wrap the client after withBasicAuth, so the credentials are added after logging.
+func withHeaderLogging(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &headerLoggingTransport{base: base}
+	return client
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json" // Decoding the API response
+	"fmt"           // Error formatting
+	"html/template" // Rendering the results as result cards
+	"mime"          // Content-Type parsing
+	"net/url"       // Resolving relative PDF URLs
+	"strings"       // Content-Type and URL handling
+)
+
+// ecolabAPIResult is one SDS sheet in a JSON response of the Ecolab search API.
+type ecolabAPIResult struct {
+	Title        string `json:"title"`        // Product name
+	CAS          string `json:"cas"`          // CAS number
+	PDFURL       string `json:"pdfUrl"`       // Link to the PDF, possibly relative
+	Language     string `json:"language"`     // Language of the sheet
+	Category     string `json:"category"`     // Product category
+	RevisionDate string `json:"revisionDate"` // Revision date of the sheet
+}
+
+// ecolabAPIResponse is a page of results of the Ecolab search API.
+type ecolabAPIResponse struct {
+	Results []ecolabAPIResult `json:"results"`
+}
+
+// isJSONContentType reports whether a Content-Type header announces JSON, including
+// vendor types such as application/vnd.api+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// extractLinksFromJSON extracts the PDF links and their metadata from a JSON response of
+// the search API, {"results": [{"title", "cas", "pdfUrl", "language", "revisionDate"}]}.
+// Relative PDF URLs are resolved against baseURL; results without a PDF are ignored.
+func extractLinksFromJSON(body []byte, baseURL string) ([]SDSLink, error) {
+	var response ecolabAPIResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON results: %w", err)
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	var links []SDSLink
+	for _, result := range response.Results {
+		reference, err := url.Parse(strings.TrimSpace(result.PDFURL))
+		if err != nil || result.PDFURL == "" {
+			continue // Nothing to download
+		}
+		pdfURL := base.ResolveReference(reference).String()
+		if !isPDFURL(pdfURL) {
+			continue
+		}
+		link := SDSLink{
+			URL:          strings.ToLower(pdfURL), // Lowercase the link for consistency with the links file
+			Language:     normalizeLanguage(result.Language),
+			Category:     result.Category,
+			ProductName:  result.Title,
+			CASNumber:    result.CAS,
+			RevisionDate: result.RevisionDate,
+		}
+		if link.Language != "" {
+			link.LanguageSource = "card"
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// resultCardsTemplate renders links as a page of SDS result cards with the same classes
+// as the search pages, so JSON results are saved and extracted like HTML pages. The
+// canonical link records the URL the results were fetched from.
+var resultCardsTemplate = template.Must(template.New("cards").Parse(`<!DOCTYPE html>
+<html><head><link rel="canonical" href="{{.PageURL}}"></head><body>
+{{range .Links}}<div class="sds-result"><span class="sds-product-name">{{.ProductName}}</span><span class="sds-cas-number">{{.CASNumber}}</span><span class="sds-language">{{.Language}}</span><span class="sds-category">{{.Category}}</span><span class="sds-revision-date">{{.RevisionDate}}</span><a href="{{.URL}}">PDF</a></div>
+{{end}}</body></html>
+`))
+
+// renderResultCards renders links as an HTML page of SDS result cards fetched from pageURL.
+func renderResultCards(links []SDSLink, pageURL string) (string, error) {
+	var page strings.Builder
+	data := struct {
+		PageURL string
+		Links   []SDSLink
+	}{PageURL: pageURL, Links: links}
+	if err := resultCardsTemplate.Execute(&page, data); err != nil {
+		return "", fmt.Errorf("error rendering result cards: %w", err)
+	}
+	return page.String(), nil
+}
@@ -1,86 +1,574 @@
 package main
 
 import (
-	"crypto/tls" // TLS for secure connections
-	"fmt"        // Formatting for strings
-	"io"         // IO operations for reading and writing files
-	"log"        // Logging for debugging and information
-	"net/http"   // HTTP client for making requests
-	"net/url"    // URL parsing and manipulation
-	"os"         // File operations
-	"path"       // Path manipulation
-	"regexp"     // Regular expressions for pattern matching
-	"strings"    // String manipulation
+	"bytes"              // Detection of compressed files
+	"compress/gzip"      // Compression of the scraped HTML
+	"container/heap"     // Priority queue of the pages to scrape
+	"context"            // Context for cancelling in-flight requests
+	"crypto/tls"         // TLS for secure connections
+	"encoding/json"      // Decoding JSON embedded in pages
+	"errors"             // Error inspection
+	"flag"               // Command line flag parsing
+	"fmt"                // Formatting for strings
+	"io"                 // IO operations for reading and writing files
+	"io/fs"              // Filesystem error values
+	"log"                // Logging for debugging and information
+	"log/slog"           // Structured logging
+	"maps"               // Map iteration helpers
+	"net/http"           // HTTP client for making requests
+	"net/http/cookiejar" // Session cookies of the search pages
+	"net/url"            // URL parsing and manipulation
+	"os"                 // File operations
+	"os/signal"          // Interrupt handling in server mode
+	"path"               // Path manipulation
+	"path/filepath"      // Platform specific path manipulation
+	"regexp"             // Regular expressions for pattern matching
+	"slices"             // Slice helpers
+	"sort"               // Sorting of page indexes
+	"strconv"            // Parsing of page offsets
+	"strings"            // String manipulation
 	"sync"
-	"time" // Time for managing timeouts
+	"syscall" // Termination signal
+	"time"    // Time for managing timeouts
+
+	"github.com/temoto/robotstxt"        // robots.txt rules
+	"go.opentelemetry.io/otel/attribute" // Span attributes
+	"go.opentelemetry.io/otel/trace"     // Span options
+	"golang.org/x/net/html"              // HTML parsing
+	"gopkg.in/natefinch/lumberjack.v2"   // Rotating log file
 )
 
-// Remove all the duplicates from a slice and return the slice.
-func removeDuplicatesFromSlice(slice []string) []string {
-	check := make(map[string]bool)
-	var newReturnSlice []string
+// RemoveDuplicatesBy removes the elements whose key was already seen, keeping the first
+// occurrence of each key in its original order, e.g. SDS links with the same URL.
+func RemoveDuplicatesBy[T any, K comparable](slice []T, key func(T) K) []T {
+	check := make(map[K]bool)
+	var newReturnSlice []T
 	for _, content := range slice {
-		if !check[content] {
-			check[content] = true
+		if contentKey := key(content); !check[contentKey] {
+			check[contentKey] = true
 			newReturnSlice = append(newReturnSlice, content)
 		}
 	}
 	return newReturnSlice
 }
 
-// scrapeContentAndSaveToFile scrapes multiple pages of SDS search results concurrently
-// and appends their HTML content to a single output file.
-func scrapeContentAndSaveToFile(outputHTMLFilePath string) {
-	// Define the total number of SDS documents expected to scrape
-	totalSDSDocuments := 12700
-	// Define how many documents are shown per search result page
-	documentsPerPage := 10
+// RemoveDuplicates removes all the duplicates from a slice of any comparable type,
+// keeping the first occurrence of each value in its original order.
+func RemoveDuplicates[T comparable](slice []T) []T {
+	return RemoveDuplicatesBy(slice, identity[T])
+}
+
+// Remove all the duplicates from a slice and return the slice.
+func removeDuplicatesFromSlice(slice []string) []string {
+	return RemoveDuplicatesBy(slice, identity[string])
+}
+
+// identity is the deduplication key of comparable values: the value itself.
+func identity[T any](value T) T {
+	return value
+}
+
+// sdsLinkURL is the deduplication key of SDS links: one download per URL.
+func sdsLinkURL(link SDSLink) string {
+	return link.URL
+}
+
+// Size of the SDS search results: the number of documents expected and how many are shown per page
+// by default. Other page sizes are requested with the "rows" query parameter.
+const (
+	totalSDSDocuments = 12700
+	documentsPerPage  = 10
+)
+
+// ScrapeOptions controls how scrapeContent fetches the SDS search result pages.
+type ScrapeOptions struct {
+	Country              string                // Country whose SDS sheets are searched (e.g. "United States")
+	MaxConsecutiveErrors int                   // Abort after this many page fetches fail in a row (0 = never abort)
+	Semaphore            chan struct{}         // Slots limiting concurrent HTTP requests, may be shared between scrapes
+	Throttle             *pageThrottle         // Minimum delay between page fetches, may be shared between scrapes (nil = none)
+	Client               *http.Client          // Client used to fetch the search result pages
+	UserAgents           []string              // User agents the pages are requested with, one picked at random per request (empty = defaultUserAgent)
+	Incremental          bool                  // Send conditional requests and skip pages that did not change
+	Offsets              []int                 // Only scrape the pages starting at these offsets (nil = all pages)
+	StartPage            int                   // First page to scrape when Offsets is nil
+	PageSize             int                   // Documents per result page (0 = documentsPerPage)
+	TotalDocuments       int                   // Documents listed by the search, e.g. from fetchSDSCount (0 = totalSDSDocuments)
+	EndPage              int                   // Scrape the pages before this one when Offsets is nil (0 = up to the last page)
+	Force                bool                  // Scrape again even when the output file is marked as complete
+	Compress             bool                  // Write every page as a separate gzip member
+	Snapshot             bool                  // Keep a copy of every page in pages/ and write all copies instead of the scraped pages (requires StateDir)
+	StateDir             string                // Directory of failed-pages.txt and pages/ with the incremental cache and page copies ("" = keep no state)
+	Robots               *robotstxt.RobotsData // Rules of the site's robots.txt (nil = not checked)
+	Stats                *Statistics           // Counters updated while scraping
+}
+
+// searchPageURL returns the URL of the search result page of country starting at offset,
+// escaping the country as a query value.
+func searchPageURL(country string, offset int, pageSize int) string {
+	query := url.Values{"countryCode": {country}, "first": {strconv.Itoa(offset)}}
+	// Only ask for a page size when it differs from the site's default, so the usual URLs stay unchanged
+	if pageSize != documentsPerPage {
+		query.Set("rows", strconv.Itoa(pageSize))
+	}
+	return BaseURL + "?" + query.Encode()
+}
+
+// doneFileSuffix is appended to the output file name to mark a completed scrape.
+const doneFileSuffix = ".done"
+
+// failedPagesFileName is the file, next to the HTML output, listing the offsets of the pages that failed.
+const failedPagesFileName = "failed-pages.txt"
+
+// readFailedPages reads the page offsets (one per line) recorded by a previous scrape.
+func readFailedPages(path string) ([]int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading failed pages: %w", err)
+	}
+	var offsets []int
+	for _, line := range splitLines(string(content)) {
+		offset, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q in %s: %w", line, path, err)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// writeFailedPages records the given page offsets (one per line) in ascending order.
+// The file is removed when there are no failed pages left.
+func writeFailedPages(path string, offsets []int) error {
+	if len(offsets) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+		return nil
+	}
+	sort.Ints(offsets)
+	var content strings.Builder
+	for _, offset := range offsets {
+		fmt.Fprintf(&content, "%d\n", offset)
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// errWritingOutput reports that scraped pages could not be written to the output; the
+// pages are recorded in failed-pages.txt.
+var errWritingOutput = errors.New("error writing scraped pages")
+
+// scrapeContentAndSaveToFile runs scrapeContent, appending the pages to the output file;
+// the state files are kept next to it unless opts.StateDir is set. With opts.Snapshot the
+// output file is replaced by the page copies instead, and a forced full scrape replaces
+// it by the scraped pages. A complete scrape, without failed or skipped pages, is marked
+// by a <output>.done file; a later full scrape of the same output is skipped unless
+// opts.Force is set (incremental runs always check the pages).
+func scrapeContentAndSaveToFile(ctx context.Context, outputHTMLFilePath string, opts ScrapeOptions) (pageErrors []PageError, err error) {
+	// Don't scrape everything a second time into an output file that is already complete
+	donePath := outputHTMLFilePath + doneFileSuffix
+	fullScrape := opts.Offsets == nil && opts.StartPage == 0 && opts.EndPage == 0
+	if fullScrape && !opts.Incremental && !opts.Force && fileExists(donePath) {
+		slog.Info("Skipping scrape, output is already complete (remove the done file or use --force to scrape again)", "output", outputHTMLFilePath, "done_file", donePath)
+		return nil, nil
+	}
+	// The output file is no longer known to be complete once pages are appended again
+	if err := os.Remove(donePath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error removing %s: %w", donePath, err)
+	}
+	if opts.StateDir == "" {
+		opts.StateDir = filepath.Dir(outputHTMLFilePath)
+	}
+	// A snapshot or a forced full scrape is written next to the old output, which it then
+	// replaces in one step; appending would repeat every page of the old output
+	replace := opts.Snapshot || (fullScrape && opts.Force && !opts.Incremental)
+	filePath, flags := outputHTMLFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY
+	if replace {
+		filePath, flags = outputHTMLFilePath+".tmp", os.O_TRUNC|os.O_CREATE|os.O_WRONLY
+	}
+	file, err := os.OpenFile(filePath, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	pageErrors, err = scrapeContent(ctx, file, opts)
+	if closeErr := file.Close(); closeErr != nil && err == nil {
+		// A delayed write failure (e.g. a full disk) loses pages like a failed write
+		err = fmt.Errorf("%w: error closing %s: %v", errWritingOutput, filePath, closeErr)
+	}
+	if replace {
+		if info, statErr := os.Stat(filePath); errors.Is(err, errWritingOutput) || (statErr == nil && info.Size() == 0) {
+			os.Remove(filePath) // Keep the previous output, also when no page was scraped
+		} else if renameErr := os.Rename(filePath, outputHTMLFilePath); renameErr != nil {
+			return pageErrors, fmt.Errorf("error replacing %s: %w", outputHTMLFilePath, renameErr)
+		}
+	}
+	if err != nil {
+		return pageErrors, err
+	}
+	// Mark the output file as complete unless pages are missing or the run was interrupted
+	if fullScrape && len(pageErrors) == 0 && ctx.Err() == nil {
+		if err := os.WriteFile(donePath, nil, 0644); err != nil {
+			slog.Error("Error marking scrape as complete", "done_file", donePath, "error", err)
+		}
+	}
+	return pageErrors, nil
+}
+
+// scrapeContent scrapes multiple pages of SDS search results concurrently and writes
+// their HTML content to w in ascending page order once all pages are done, every page
+// as a separate gzip member with opts.Compress. Pages are fetched from a priority queue:
+// the pages listed in failed-pages.txt by the previous run come first, and pages failing
+// with a retryable error are queued again ahead of the fresh pages, up to maxPageAttempts
+// fetches. The offsets of the pages that could not be scraped or written are recorded in
+// failed-pages.txt in opts.StateDir, and the pages are returned with the error of their
+// last attempt, so the caller can decide whether the run failed. Pages skipped because
+// robots.txt disallows them (errRobotsDisallowed) or because of an invalid encoding are
+// missing from the output as well and are returned the same way.
+// If opts.MaxConsecutiveErrors page fetches fail in a row, the remaining pages
+// are cancelled and an error describing the unscraped range is returned. A failed write
+// to w is returned wrapping errWritingOutput.
+func scrapeContent(ctx context.Context, w io.Writer, opts ScrapeOptions) (pageErrors []PageError, err error) {
+	if opts.Snapshot && opts.StateDir == "" {
+		return nil, fmt.Errorf("snapshot scrapes need a state directory for the page copies")
+	}
 	// Calculate the total number of result pages needed to scrape all documents
-	totalPages := (totalSDSDocuments + documentsPerPage - 1) / documentsPerPage
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = documentsPerPage
+	}
+	totalDocuments := opts.TotalDocuments
+	if totalDocuments == 0 {
+		totalDocuments = totalSDSDocuments
+	}
+	totalPages := (totalDocuments + pageSize - 1) / pageSize
+	// Derive a cancellable context so a run of failures can abort the remaining pages
+	ctx, cancel := context.WithCancel(ctx)
+	// Release the context resources once all pages are done
+	defer cancel()
+	// Load the ETag / Last-Modified sidecar when scraping incrementally
+	var cache *pageCache
+	if opts.Incremental && opts.StateDir != "" {
+		cache = loadPageCache(filepath.Join(opts.StateDir, "pages", ".etags.json"))
+	}
 	// Create a WaitGroup to wait for all scraping goroutines to complete
 	var waitGroup sync.WaitGroup
-	// Create a Mutex to safely write to the output file from multiple goroutines
-	var fileWriteMutex sync.Mutex
-	// Create a buffered channel to limit the number of concurrent HTTP requests (semaphore pattern)
-	concurrentRequestsLimit := 10
-	concurrencySemaphore := make(chan struct{}, concurrentRequestsLimit)
-	// Iterate through each page index from 0 to totalPages - 1
-	for pageIndex := 0; pageIndex < totalPages; pageIndex++ {
+	// Collect the HTML of every scraped page by offset, so the pages are written in order
+	pageHTML := make(map[int]string)
+	// Create a Mutex to safely collect the pages from multiple goroutines
+	var pageHTMLMutex sync.Mutex
+	// Create a Mutex guarding the error counter, the abort reason and the skipped pages
+	var abortMutex sync.Mutex
+	// Count how many page fetches have failed in a row
+	consecutiveErrors := 0
+	// Remember why the scrape was aborted (nil while still running normally)
+	var abortReason error
+	// Collect the pages that were never scraped because of the abort
+	var skippedPages []int
+	// Collect the pages whose fetch failed
+	var failedPages []int
+	// Use the buffered channel from the options to limit the number of concurrent HTTP requests (semaphore pattern)
+	concurrencySemaphore := opts.Semaphore
+	if concurrencySemaphore == nil {
+		concurrentRequestsLimit := 10
+		concurrencySemaphore = make(chan struct{}, concurrentRequestsLimit)
+	}
+	// Scrape every page from StartPage to EndPage - 1, or only the requested offsets
+	endPage := opts.EndPage
+	if endPage == 0 {
+		endPage = totalPages
+	}
+	var pageIndexes []int
+	if opts.Offsets != nil {
+		for _, offset := range opts.Offsets {
+			pageIndexes = append(pageIndexes, offset/pageSize)
+		}
+	} else {
+		for pageIndex := opts.StartPage; pageIndex < endPage; pageIndex++ {
+			pageIndexes = append(pageIndexes, pageIndex)
+		}
+	}
+	// Record a page as skipped when the scrape has been aborted before fetching it
+	markSkipped := func(pageIndex int) {
+		opts.Stats.Skipped.Add(1)
+		abortMutex.Lock()
+		skippedPages = append(skippedPages, pageIndex)
+		abortMutex.Unlock()
+	}
+	// Queue the pages, the ones that failed in the previous run first
+	failedPagesPath := filepath.Join(opts.StateDir, failedPagesFileName)
+	var previousFailures []int
+	var otherFailedOffsets []int // Failed pages outside the scraped range, still to be retried
+	if opts.StateDir != "" {
+		if offsets, err := readFailedPages(failedPagesPath); err == nil {
+			scraped := make(map[int]bool, len(pageIndexes))
+			for _, pageIndex := range pageIndexes {
+				scraped[pageIndex] = true
+			}
+			for _, offset := range offsets {
+				if scraped[offset/pageSize] {
+					previousFailures = append(previousFailures, offset/pageSize)
+				} else {
+					otherFailedOffsets = append(otherFailedOffsets, offset)
+				}
+			}
+		}
+	}
+	queue := newPageQueue(pageIndexes, previousFailures)
+	// Create a Mutex guarding the queue, which the page goroutines push failed pages back into
+	var queueMutex sync.Mutex
+	// Count the pages being scraped, which may still be queued again
+	inFlight := 0
+	// Wake the dispatcher up when a page is done
+	pageDone := make(chan struct{}, 1)
+	// Hand out the most urgent page whenever a request slot is free
+	for {
+		// Acquire a slot in the semaphore to limit concurrency, unless the scrape is aborted first
+		acquired := false
+		select {
+		case concurrencySemaphore <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+		queueMutex.Lock()
+		// Stop when aborted (the abort may have happened while both select cases were ready) or when all pages are done
+		if ctx.Err() != nil || (queue.Len() == 0 && inFlight == 0) {
+			queueMutex.Unlock()
+			if acquired {
+				<-concurrencySemaphore
+			}
+			break
+		}
+		// Pages in flight may still be queued again, wait for one of them
+		if queue.Len() == 0 {
+			queueMutex.Unlock()
+			<-concurrencySemaphore
+			<-pageDone
+			continue
+		}
+		item := heap.Pop(queue).(pageQueueItem)
+		item.attempts++
+		inFlight++
+		queueMutex.Unlock()
+		// Keep the minimum delay since the previous page fetch of any scrape
+		if err := opts.Throttle.wait(ctx); err != nil {
+			queueMutex.Lock()
+			heap.Push(queue, item) // Marked as skipped after the loop
+			inFlight--
+			queueMutex.Unlock()
+			<-concurrencySemaphore
+			break
+		}
 		// Increase the WaitGroup counter for each launched goroutine
 		waitGroup.Add(1)
 		// Launch a goroutine for concurrent scraping of each page
-		go func(currentPage int) {
+		go func(item pageQueueItem) {
 			// Decrease the WaitGroup counter when the goroutine finishes
 			defer waitGroup.Done()
-			// Calculate the "offset" (start index) for the current page's SDS documents
-			offset := currentPage * documentsPerPage
-			// Format the URL for the current page using the offset value
-			pageURL := fmt.Sprintf("https://www.ecolab.com/sds-search?countryCode=United%%20States&first=%d", offset)
-			// Acquire a slot in the semaphore to limit concurrency
-			concurrencySemaphore <- struct{}{}
 			// Release the semaphore slot after the function ends
 			defer func() { <-concurrencySemaphore }()
+			// Let the dispatcher know, after the page may have been queued again
+			defer func() {
+				queueMutex.Lock()
+				inFlight--
+				queueMutex.Unlock()
+				select {
+				case pageDone <- struct{}{}:
+				default: // The dispatcher is already being woken up
+				}
+			}()
+			currentPage := item.pageIndex
+			// Calculate the "offset" (start index) for the current page's SDS documents
+			offset := currentPage * pageSize
+			// Build the URL of the current page from the offset
+			pageURL := searchPageURL(opts.Country, offset, pageSize)
+			// Respect the site's robots.txt unless told otherwise
+			if !robotsAllowed(opts.Robots, pageURL) {
+				slog.Warn("robots.txt disallows page, skipping", "page", currentPage+1, "url", pageURL)
+				opts.Stats.Skipped.Add(1)
+				// The page is missing from the output, but retrying it cannot help
+				abortMutex.Lock()
+				pageErrors = append(pageErrors, PageError{Page: currentPage + 1, Offset: offset, URL: pageURL, Err: errRobotsDisallowed})
+				abortMutex.Unlock()
+				return
+			}
+			// Trace the whole page, so the fetch span is recorded with its offset
+			pageCtx, span := tracer.Start(ctx, "scrapePage", trace.WithAttributes(attribute.Int("page.offset", offset)))
+			defer span.End()
 			// Perform HTTP GET to fetch the HTML content of the current page
-			htmlContent, err := fetchPageHTML(pageURL)
+			htmlContent, err := fetchPageHTML(pageCtx, opts.Client, pageURL, cache, opts.UserAgents)
+			// An unchanged page is already in the output file from a previous run
+			if errors.Is(err, errPageNotModified) {
+				abortMutex.Lock()
+				consecutiveErrors = 0
+				abortMutex.Unlock()
+				slog.Info("Page not modified, skipping", "page", currentPage+1)
+				opts.Stats.Skipped.Add(1)
+				return
+			}
 			// Handle any error that occurred while fetching the page
 			if err != nil {
-				log.Printf("Error scraping page %d: %v\n", currentPage+1, err)
+				// Requests cancelled by the abort are skipped pages, not new failures
+				if ctx.Err() != nil {
+					markSkipped(currentPage)
+					return
+				}
+				slog.Error("Error scraping page", "page", currentPage+1, "attempt", item.attempts, "max_attempts", maxPageAttempts, "error", err)
+				opts.Stats.Errors.Add(1)
+				abortMutex.Lock()
+				// Retry the page ahead of the fresh pages, or remember it so it can be retried
+				// later, unless retrying cannot help (e.g. 404)
+				retryable := isRetryable(err)
+				if retryable && item.attempts < maxPageAttempts {
+					item.failures++
+					queueMutex.Lock()
+					heap.Push(queue, item)
+					queueMutex.Unlock()
+				} else {
+					if retryable {
+						failedPages = append(failedPages, currentPage)
+					}
+					pageErrors = append(pageErrors, PageError{Page: currentPage + 1, Offset: offset, URL: pageURL, Err: err})
+				}
+				// Count this failure and abort everything once the limit is reached
+				consecutiveErrors++
+				if opts.MaxConsecutiveErrors > 0 && consecutiveErrors >= opts.MaxConsecutiveErrors && abortReason == nil {
+					abortReason = fmt.Errorf("%d consecutive page fetches failed, last error: %w", consecutiveErrors, err)
+					cancel()
+				}
+				abortMutex.Unlock()
 				return
 			}
-			// Lock the file writing to prevent concurrent access from other goroutines
-			fileWriteMutex.Lock()
-			// Ensure the mutex is unlocked after file writing is complete
-			defer fileWriteMutex.Unlock()
-			// Append the HTML content to the specified output file
-			appendByteToFile(outputHTMLFilePath, []byte(htmlContent))
+			// A successful fetch breaks the run of failures
+			abortMutex.Lock()
+			consecutiveErrors = 0
+			abortMutex.Unlock()
+			// Never append a page with broken multibyte sequences to the output file
+			htmlContent, transcoded, err := ensureUTF8(htmlContent)
+			if err != nil {
+				// Keep the raw bytes for inspection
+				rawPath := ""
+				if opts.StateDir != "" {
+					pagesDir := filepath.Join(opts.StateDir, "pages")
+					rawPath = filepath.Join(pagesDir, strconv.Itoa(offset)+".bin")
+					if dirErr := ensureDir(0755, pagesDir); dirErr != nil {
+						slog.Error("Error creating raw page directory", "error", dirErr)
+					} else if writeErr := os.WriteFile(rawPath, []byte(htmlContent), 0644); writeErr != nil {
+						slog.Error("Error saving raw page", "page", currentPage+1, "path", rawPath, "error", writeErr)
+					}
+				}
+				slog.Warn("Skipping page with invalid encoding", "page", currentPage+1, "error", err, "raw", rawPath)
+				opts.Stats.Skipped.Add(1)
+				// The page is missing from the output; retry it with --retry-failed once the site is fixed
+				abortMutex.Lock()
+				failedPages = append(failedPages, currentPage)
+				pageErrors = append(pageErrors, PageError{Page: currentPage + 1, Offset: offset, URL: pageURL, Err: err})
+				abortMutex.Unlock()
+				return
+			}
+			if transcoded {
+				slog.Warn("Page is not valid UTF-8, decoded it as ISO-8859-1", "page", currentPage+1)
+			}
+			// Verify the page size on the first page; only the last page may hold fewer results
+			if currentPage == pageIndexes[0] && currentPage < totalPages-1 {
+				if results := countSDSResults(htmlContent); results != pageSize {
+					slog.Warn("Page holds a different number of results than the page size, the pagination may miss or repeat documents",
+						"page", currentPage+1, "results", results, "page_size", pageSize)
+				}
+			}
+			// Keep the HTML content until all pages are done
+			pageHTMLMutex.Lock()
+			pageHTML[offset] = htmlContent
+			pageHTMLMutex.Unlock()
 			// Log the success of this page scraping
-			log.Printf("Page %d scraped and saved to file.\n", currentPage+1)
-		}(pageIndex) // Pass pageIndex into the goroutine to avoid variable capture issues
+			slog.Info("Page scraped", "page", currentPage+1)
+			opts.Stats.PagesScraped.Add(1)
+			opts.Stats.LastPageScraped.Store(int64(currentPage + 1))
+		}(item) // Pass the item into the goroutine to avoid variable capture issues
 	}
 	// Wait for all launched goroutines to finish before continuing
 	waitGroup.Wait()
+	// The pages still queued when the scrape was aborted were never scraped
+	for queue.Len() > 0 {
+		markSkipped(heap.Pop(queue).(pageQueueItem).pageIndex)
+	}
+	// Write the pages in ascending offset order, so the output of two runs can be diffed
+	var writeErr error
+	if opts.Snapshot {
+		// Keep a copy of every page and write all copies, so the output reflects the current site
+		pagesDir := filepath.Join(opts.StateDir, "pages")
+		if writeErr = writePageSnapshot(pagesDir, pageHTML); writeErr == nil {
+			writeErr = writeSnapshotPages(w, pagesDir, opts.Compress)
+		}
+		if writeErr != nil {
+			writeErr = fmt.Errorf("%w: %v", errWritingOutput, writeErr)
+		}
+	} else {
+		for _, offset := range slices.Sorted(maps.Keys(pageHTML)) {
+			if writeErr != nil {
+				// Retry the pages that could not be written with --retry-failed
+				failedPages = append(failedPages, offset/pageSize)
+				continue
+			}
+			if err := writePage(w, []byte(pageHTML[offset]), opts.Compress); err != nil {
+				writeErr = fmt.Errorf("%w: page %d: %v", errWritingOutput, offset/pageSize+1, err)
+				failedPages = append(failedPages, offset/pageSize)
+			}
+		}
+	}
+	// Persist the validators for the next incremental run
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			slog.Error("Error saving page cache", "error", err)
+		}
+	}
+	// Record the offsets of every page that was not scraped for --retry-failed, together
+	// with the failures of earlier runs outside the scraped pages, e.g. of another --pages range
+	failedOffsets := otherFailedOffsets
+	for _, pageIndex := range append(failedPages, skippedPages...) {
+		failedOffsets = append(failedOffsets, pageIndex*pageSize)
+	}
+	if opts.StateDir != "" {
+		if err := writeFailedPages(failedPagesPath, failedOffsets); err != nil {
+			slog.Error("Error saving failed pages", "path", failedPagesPath, "error", err)
+		}
+	}
+	// Report the failed pages in page order
+	slices.SortFunc(pageErrors, func(a, b PageError) int { return a.Page - b.Page })
+	// Losing scraped pages is worse than an abort, report it first
+	if writeErr != nil {
+		return pageErrors, writeErr
+	}
+	// Report the reason and the unscraped page range if the scrape was aborted
+	if abortReason != nil {
+		// Sort the skipped pages so the first and last ones describe the range
+		sort.Ints(skippedPages)
+		if len(skippedPages) == 0 {
+			return pageErrors, fmt.Errorf("scrape aborted: %w", abortReason)
+		}
+		return pageErrors, fmt.Errorf("scrape aborted: %w; pages %d-%d were not scraped (%d pages)",
+			abortReason, skippedPages[0]+1, skippedPages[len(skippedPages)-1]+1, len(skippedPages))
+	}
 	// Log a final message once all pages have been processed
-	log.Printf("Completed scraping all %d pages. Results saved to: %s\n", totalPages, outputHTMLFilePath)
+	slog.Info("Completed scraping", "pages", len(pageIndexes), "failed", len(pageErrors), "country", opts.Country)
+	return pageErrors, nil
+}
+
+/*
+It looks up the path, following symlinks.
+A missing path is reported as not existing without an error;
+any other failure (e.g. permission denied) is returned.
+*/
+func statPath(p string) (exists bool, isDir bool, err error) {
+	info, err := os.Stat(p) // Get file info
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil // Path does not exist
+	}
+	if err != nil {
+		return false, false, err // Existence unknown
+	}
+	return true, info.IsDir(), nil
 }
 
 /*
@@ -89,61 +577,234 @@ If the file exists, it returns true.
 If the file does not exist, it returns false.
 */
 func fileExists(filename string) bool {
-	info, err := os.Stat(filename) // Get file info
-	if err != nil {
-		return false // File does not exist
+	exists, isDir, err := statPath(filename)
+	return err == nil && exists && !isDir // Return true if it’s a file (not directory)
+}
+
+// validateLogRotation checks the --log-max-size-mb and --log-max-backups values.
+func validateLogRotation(maxSizeMB int, maxBackups int) error {
+	if maxSizeMB < 1 {
+		return fmt.Errorf("invalid --log-max-size-mb %d (expected 1 or more)", maxSizeMB)
 	}
-	return !info.IsDir() // Return true if it’s a file (not directory)
+	if maxBackups < 0 {
+		return fmt.Errorf("invalid --log-max-backups %d (expected 0 or more)", maxBackups)
+	}
+	return nil
 }
 
-// fetchPageHTML performs a simple HTTP GET request to retrieve the raw HTML
-// of the given URL without executing any JavaScript and disables HTTP/2.
-func fetchPageHTML(pageURL string) (string, error) {
+// newRotatingLogFile returns the --log-file writer, rotated once it reaches maxSizeMB
+// and keeping maxBackups old files (0 = all). The file is opened on the first write.
+func newRotatingLogFile(path string, maxSizeMB int, maxBackups int) *lumberjack.Logger {
+	return &lumberjack.Logger{Filename: path, MaxSize: maxSizeMB, MaxBackups: maxBackups}
+}
+
+// Default timeouts of the two HTTP clients: search pages are small, PDFs can be very large.
+const (
+	htmlRequestTimeout = 15 * time.Second
+	pdfRequestTimeout  = 10 * time.Minute
+)
+
+// newHTTPClient creates an HTTP client with the given timeout that disables HTTP/2.
+func newHTTPClient(timeout time.Duration) *http.Client {
 	// Create a custom transport with an empty TLSNextProto map to disable HTTP/2
 	transport := &http.Transport{
 		TLSNextProto: make(map[string]func(string, *tls.Conn) http.RoundTripper),
 	}
 
-	// Create an HTTP client with the custom transport and a timeout of 30 seconds
-	client := &http.Client{
+	// Create an HTTP client with the custom transport and the requested timeout
+	return &http.Client{
 		Transport: transport,
-		Timeout:   60 * time.Second,
+		Timeout:   timeout,
+	}
+}
+
+// withCookieJar makes client store the cookies set by the responses and send them
+// with the subsequent requests, like a browser session.
+func withCookieJar(client *http.Client) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		slog.Error("Error creating cookie jar", "error", err) // Never happens without options
+		return client
+	}
+	client.Jar = jar
+	return client
+}
+
+// newScraperClients creates the client of the search pages, which sends the session
+// cookies set by the site (e.g. anti-bot cookies) with every later page request, and the
+// client of the PDF downloads with pdfTimeout. Both apply the TLS options and count their
+// requests and new connections in stats. The warning of an insecure client goes to stderr.
+func newScraperClients(opts tlsOptions, pdfTimeout time.Duration, stats *Statistics, stderr io.Writer) (htmlClient *http.Client, pdfClient *http.Client, err error) {
+	// Use a short timeout for search pages and a long one for PDF downloads
+	htmlClient = withCookieJar(newHTTPClient(htmlRequestTimeout))
+	pdfClient = newHTTPClient(pdfTimeout)
+	// Only accept the pinned certificates when fingerprints are given
+	if opts.Fingerprints != "" {
+		var fingerprints [][]byte
+		for _, value := range splitCommaList(opts.Fingerprints) {
+			fingerprint, err := parseTLSFingerprint(value)
+			if err != nil {
+				return nil, nil, err
+			}
+			fingerprints = append(fingerprints, fingerprint)
+		}
+		htmlClient = withPinnedCertificate(htmlClient, fingerprints)
+		pdfClient = withPinnedCertificate(pdfClient, fingerprints)
+	}
+	// Trust the corporate CA of a TLS inspection proxy when one is given
+	if opts.CACert != "" {
+		pool, err := loadCACertPool(opts.CACert)
+		if err != nil {
+			return nil, nil, err
+		}
+		htmlClient = withRootCAs(htmlClient, pool)
+		pdfClient = withRootCAs(pdfClient, pool)
+	}
+	// Skip certificate verification only when explicitly asked to
+	if opts.Insecure {
+		fmt.Fprintln(stderr, "WARNING: --tls-insecure disables TLS certificate verification. Connections can be intercepted")
+		fmt.Fprintln(stderr, "WARNING: and the scraped pages and PDFs tampered with. Only use it for trusted intranet mirrors.")
+		htmlClient = withInsecureTLS(htmlClient)
+		pdfClient = withInsecureTLS(pdfClient)
+	}
+	// Count the requests and new connections, to see whether keep-alive connections are reused
+	return withConnectionCounting(htmlClient, stats), withConnectionCounting(pdfClient, stats), nil
+}
+
+// maxErrorBodySize is how much of the body of an error answer is kept in its FetchError.
+const maxErrorBodySize = 1024
+
+// readErrorBody returns the start of the decompressed body of an error answer, for the
+// error message. A body that cannot be read is reported as empty.
+func readErrorBody(resp *http.Response) string {
+	bodyReader, err := decodedBody(resp)
+	if err != nil {
+		return ""
 	}
+	body, _ := io.ReadAll(io.LimitReader(bodyReader, maxErrorBodySize))
+	return strings.TrimSpace(string(body))
+}
 
+// fetchPageHTML performs a simple HTTP GET request to retrieve the raw HTML
+// of the given URL without executing any JavaScript, using the given client.
+// The request is aborted when ctx is cancelled. When cache is not nil the request
+// is made conditional and errPageNotModified is returned on 304 Not Modified. A 429 Too
+// Many Requests answer is retried up to maxRateLimitRetries times after its Retry-After delay,
+// a 503 Service Unavailable answer up to maxUnavailableRetries times with exponential backoff.
+// The request is sent with one of userAgents, see pageUserAgent.
+func fetchPageHTML(ctx context.Context, client *http.Client, pageURL string, cache *pageCache, userAgents []string) (htmlContent string, err error) {
+	// Trace the request, recording its URL and outcome
+	ctx, span := tracer.Start(ctx, "fetchPageHTML", trace.WithAttributes(attribute.String("http.url", pageURL)))
+	defer func() {
+		// A 304 answer to a conditional request is not a failure
+		if errors.Is(err, errPageNotModified) {
+			span.End()
+			return
+		}
+		endSpan(span, err)
+	}()
 	// Create a new HTTP GET request for the target pageURL
-	req, err := http.NewRequest("GET", pageURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
 	if err != nil {
 		// Return an error if the request creation fails
 		return "", fmt.Errorf("failed to create request for %s: %w", pageURL, err)
 	}
 
-	// Set a custom User-Agent header to mimic a browser or bot identity
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; EcolabBot/1.0)")
+	// Set a custom User-Agent header to mimic a browser or bot identity, from --ua-list-url when loaded
+	req.Header.Set("User-Agent", pageUserAgent(userAgents))
 
-	// Send the request using the HTTP client
-	resp, err := client.Do(req)
+	// Accept compressed pages; the body is decompressed below
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	// Ask the server to skip the body if the page did not change since the last run
+	if cache != nil {
+		cache.applyConditionalHeaders(req)
+	}
+
+	// Send the request using the HTTP client, waiting and retrying while rate limited or unavailable
+	resp, err := doWithUnavailableRetries(ctx, client, req)
 	if err != nil {
 		// Return an error if the request fails to execute
-		return "", fmt.Errorf("failed to GET %s: %w", pageURL, err)
+		return "", &FetchError{URL: pageURL, Err: err}
 	}
 	// Ensure the response body is closed after reading
 	defer resp.Body.Close()
+	// Record the status code on the span
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	// The page is unchanged since the validators were recorded
+	if resp.StatusCode == http.StatusNotModified && cache != nil {
+		return "", errPageNotModified
+	}
+
+	// Still unavailable after all retries: keep the start of the maintenance page for the log
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Body: readErrorBody(resp)}
+	}
 
 	// Check that the server responded with HTTP 200 OK
 	if resp.StatusCode != http.StatusOK {
 		// Return an error if the status code indicates a failure
-		return "", fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, pageURL)
+		return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode}
 	}
 
-	// Read the entire response body into memory
-	body, err := io.ReadAll(resp.Body)
+	// Decompress the body according to its Content-Encoding
+	bodyReader, err := decodedBody(resp)
 	if err != nil {
-		// Return an error if reading the body fails
-		return "", fmt.Errorf("failed to read response body for %s: %w", pageURL, err)
+		return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: err}
 	}
 
-	// Convert the byte slice to a string and return it
-	return string(body), nil
+	// Results served by the JSON API are saved as result cards, so they are extracted like HTML pages
+	if isJSONContentType(resp.Header.Get("Content-Type")) {
+		body, err := io.ReadAll(bodyReader)
+		if err != nil {
+			return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: fmt.Errorf("failed to read response body: %w", err)}
+		}
+		links, err := extractLinksFromJSON(body, pageURL)
+		if err != nil {
+			return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: err}
+		}
+		if htmlContent, err = renderResultCards(links, pageURL); err != nil {
+			return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: err}
+		}
+	} else {
+		// Stream the decompressed body through the HTML tokenizer instead of reading it whole first
+		if htmlContent, err = readHTMLTokens(bodyReader, resp.ContentLength); err != nil {
+			return "", &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: fmt.Errorf("failed to read response body: %w", err)}
+		}
+	}
+
+	// Remember the validators for the next incremental run
+	if cache != nil {
+		cache.record(pageURL, resp.Header)
+	}
+	return htmlContent, nil
+}
+
+// maxPageSizeHint caps the memory reserved for a page up front.
+const maxPageSizeHint = 64 << 20
+
+// readHTMLTokens reads an HTML page from r through html.NewTokenizer, appending the raw
+// bytes of every token to the page as they are read, so the body is buffered only once.
+// The page is returned byte for byte as served, including invalid UTF-8 and broken
+// markup, which are dealt with by ensureUTF8 and the link extraction. sizeHint is the
+// expected size of the page, e.g. the Content-Length of the response (-1 = unknown).
+func readHTMLTokens(r io.Reader, sizeHint int64) (string, error) {
+	tokenizer := html.NewTokenizer(r)
+	var page strings.Builder
+	if sizeHint > 0 {
+		page.Grow(int(min(sizeHint, maxPageSizeHint))) // Don't trust a huge Content-Length
+	}
+	for {
+		tokenType := tokenizer.Next()
+		page.Write(tokenizer.Raw()) // The error token holds the unterminated rest of the page
+		if tokenType == html.ErrorToken {
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return page.String(), err
+			}
+			return page.String(), nil
+		}
+	}
 }
 
 /*
@@ -152,158 +813,1562 @@ If it exists, return true.
 If it doesn't, return false.
 */
 func directoryExists(path string) bool {
-	directory, err := os.Stat(path)
+	exists, isDir, err := statPath(path)
+	return err == nil && exists && isDir
+}
+
+// averageSDSFileSize is the approximate size of one SDS PDF, used to estimate the download size.
+const averageSDSFileSize = 500 * 1024
+
+// checkAvailableDiskSpace verifies that the filesystem holding dir has room for estimatedBytes.
+// It returns an error when the space is insufficient and logs a warning when less than 20% headroom remains.
+func checkAvailableDiskSpace(dir string, estimatedBytes int64) error {
+	// Walk up to the nearest existing directory, since the download folder may not exist yet
+	for !directoryExists(dir) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+	}
+	// Query the free space of the filesystem holding the directory
+	availableBytes, err := diskFreeBytes(dir)
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to check disk space for %s: %w", dir, err)
+	}
+	// Fail early instead of running out of space half way through the download
+	if availableBytes < estimatedBytes {
+		return fmt.Errorf("not enough disk space in %s: %d MB available, about %d MB needed",
+			dir, availableBytes/(1024*1024), estimatedBytes/(1024*1024))
 	}
-	return directory.IsDir()
+	// Warn when the download would leave less than 20% headroom
+	if availableBytes < estimatedBytes+estimatedBytes/5 {
+		slog.Warn("Low disk space", "dir", dir, "available_mb", availableBytes/(1024*1024), "needed_mb", estimatedBytes/(1024*1024))
+	}
+	return nil
 }
 
 /*
-The function takes two parameters: path and permission.
-We use os.Mkdir() to create the directory.
-If there is an error, we use log.Println() to log the error and then exit the program.
+The function takes the permission and the path components of the directory.
+The components are joined with filepath.Join, e.g. ensureDir(0755, dir, "PDFs", category),
+and os.MkdirAll() creates the directory along with any missing parents.
+If there is an error, it is returned to the caller.
 */
-func createDirectory(path string, permission os.FileMode) {
-	err := os.Mkdir(path, permission)
+func ensureDir(permission os.FileMode, parts ...string) error {
+	path := filepath.Join(parts...)
+	err := os.MkdirAll(path, permission)
+	if err != nil {
+		return fmt.Errorf("error creating directory %s: %w", path, err)
+	}
+	return nil
+}
+
+// Errors returned by downloadPDF for PDFs that are skipped rather than failed.
+var (
+	errFileTooLarge = errors.New("PDF exceeds the maximum file size") // Larger than DownloadOptions.MaxFileSize
+	errNotPDF       = errors.New("resource is not a PDF")             // Announced with another Content-Type
+)
+
+// errInvalidPDF is returned by downloadPDF for downloads that turned out not to be PDFs,
+// e.g. error pages served with a .pdf extension; the file is deleted.
+var errInvalidPDF = errors.New("downloaded file is not a valid PDF")
+
+// pdfHeaderWindow is how far into a file the %PDF- header is looked for; readers accept
+// some leading garbage before it.
+const pdfHeaderWindow = 1024
+
+// checkPDFHeader reports an error unless the file starts with the %PDF- magic bytes.
+func checkPDFHeader(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+	header := make([]byte, pdfHeaderWindow)
+	read, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	if !bytes.Contains(header[:read], []byte("%PDF-")) {
+		return errors.New("no %PDF- header")
+	}
+	return nil
+}
+
+// isSkippedDownload reports whether downloadPDF skipped the PDF on purpose.
+func isSkippedDownload(err error) bool {
+	return errors.Is(err, errFileTooLarge) || errors.Is(err, errNotPDF) || errors.Is(err, errInvalidPDFURL)
+}
+
+// pdfContentTypes are the Content-Types accepted for PDFs. Some CDNs serve every
+// file as generic binary data, so application/octet-stream is accepted as well.
+var pdfContentTypes = []string{"application/pdf", "application/x-pdf", "application/octet-stream"}
+
+// isPDFContentType reports whether a Content-Type header announces a PDF (an empty header is accepted).
+func isPDFContentType(contentType string) bool {
+	if contentType == "" {
+		return true // Nothing announced; the download will tell
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return slices.Contains(pdfContentTypes, strings.ToLower(strings.TrimSpace(mediaType)))
+}
+
+// headPDF sends a HEAD request and returns the Content-Length (-1 if unknown) and the
+// headers of the resource, e.g. its Content-Type and Accept-Ranges.
+func headPDF(ctx context.Context, client *http.Client, pdfURL string, referer string) (contentLength int64, header http.Header, err error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", pdfURL, nil) // Create the HEAD request
+	if err != nil {
+		return -1, nil, fmt.Errorf("error creating HEAD request for %s: %w", pdfURL, err)
+	}
+	req.Header.Set("Referer", referer) // Like a click on the search page
+	resp, err := client.Do(req)        // Send the HEAD request
 	if err != nil {
-		log.Println(err)
+		return -1, nil, fmt.Errorf("error sending HEAD request for %s: %w", pdfURL, err)
+	}
+	resp.Body.Close()                     // A HEAD response has no body to read
+	if resp.StatusCode != http.StatusOK { // Only a successful answer carries meaningful metadata
+		return -1, nil, fmt.Errorf("status code error for HEAD %s: %d %s", pdfURL, resp.StatusCode, resp.Status)
 	}
+	return resp.ContentLength, resp.Header, nil
 }
 
-// downloadPDF downloads a PDF from a URL and saves it into the specified folder.
-func downloadPDF(pdfURL, folder string) error {
-	fileName := getFileNamesFromURLs(pdfURL) // Get file name from the URL
-	fullPath := path.Join(folder, fileName)  // Combine folder and file name to get full path
-	if fileExists(fullPath) {                // Check if file already exists
-		log.Printf("File %s already exists, skipping download.", fullPath)
-		return nil // Skip download if file exists
+// downloadPDF downloads the PDF of a link and saves it into the specified folder. Every
+// request is sent with the page the link was found on as its Referer.
+// A file left over by an interrupted download is detected by comparing its size with the
+// Content-Length of the PDF and is completed with a Range request. When expected is not nil
+// (the manifest entry of an earlier complete download), the resumed file is verified
+// against its checksum, and a complete file is only downloaded again when the server
+// reports a change of the ETag / Last-Modified validators recorded in expected. New and
+// partial downloads are preceded by a HEAD pre-flight: resources announced with another
+// Content-Type are skipped with errNotPDF, PDFs larger than opts.MaxFileSize with
+// errFileTooLarge. Downloads without a %PDF- header or smaller than opts.MinFileSize are
+// deleted with errInvalidPDF. The server metadata of the file on disk is returned for the
+// manifest. The download uses opts.Client, is counted in opts.Stats and logged through
+// opts.Logger (falling back to slog.Default() when nil).
+func downloadPDF(ctx context.Context, opts DownloadOptions, link SDSLink, folder string, expected *ManifestEntry) (meta pdfMetadata, err error) {
+	pdfURL := link.URL  // URL of the PDF
+	stats := opts.Stats // Counters of the current run
+	// Trace the download, recording its URL, status code and size
+	ctx, span := tracer.Start(ctx, "downloadPDF", trace.WithAttributes(attribute.String("http.url", pdfURL)))
+	defer func() { endSpan(span, err) }()
+	// Count every failed download; PDFs skipped on purpose are counted as skipped
+	defer func() {
+		if isSkippedDownload(err) {
+			stats.Skipped.Add(1)
+		} else if err != nil {
+			stats.Errors.Add(1)
+			stats.DownloadErrors.Add(1)
+		}
+		// Let callers tell download failures apart with errors.As
+		if err != nil {
+			err = &DownloadError{PDFURL: pdfURL, Err: err}
+		}
+	}()
+
+	// Keep the metadata of the earlier download unless the file is downloaded again
+	if expected != nil {
+		meta = expected.pdfMetadata
+	}
+	fileName, err := getFileNamesFromURLs(pdfURL) // Get file name from the URL
+	if err != nil {
+		return meta, err // Nothing sensible to save the download as
+	}
+	fullPath := path.Join(folder, fileName) // Combine folder and file name to get full path
+	var resumeFrom int64                    // Number of bytes already on disk from an interrupted download
+	conditional := false                    // Whether only a changed PDF is downloaded again
+	remoteSize := int64(-1)                 // Content-Length of the PDF, when known
+	if fileExists(fullPath) {               // Check if file already exists
+		info, err := os.Stat(fullPath) // Get the size of the existing file
+		if err != nil {
+			return meta, fmt.Errorf("error checking existing file: %w", err)
+		}
+		if expected != nil && expected.Size == info.Size() {
+			// A file matching the manifest was completed by an earlier run
+			if meta.pageValidators == (pageValidators{}) {
+				slog.Info("File already exists, skipping download", "path", fullPath)
+				stats.Skipped.Add(1)
+				return meta, nil // Skip download if file exists and cannot be checked for changes
+			}
+			conditional = true // Ask the server whether the PDF changed since
+		} else {
+			// Compare the local size with the remote size to detect a partial download
+			var header http.Header
+			remoteSize, header, err = headPDF(ctx, opts.Client, pdfURL, link.referer())
+			meta.ContentType = header.Get("Content-Type")
+			if err != nil || remoteSize <= 0 || info.Size() >= remoteSize {
+				slog.Info("File already exists, skipping download", "path", fullPath)
+				stats.Skipped.Add(1)
+				return meta, nil // Skip download if file exists (or its completeness cannot be checked)
+			}
+			resumeFrom = info.Size()
+			slog.Info("Resuming partial download", "path", fullPath, "offset", resumeFrom, "size", remoteSize)
+		}
+	}
+	// Pre-flight a new download, learning its size and type before downloading anything
+	var headHeader http.Header // Headers of the pre-flight, nil when it failed
+	if !conditional && resumeFrom == 0 {
+		if remoteSize, headHeader, err = headPDF(ctx, opts.Client, pdfURL, link.referer()); err != nil {
+			remoteSize = -1 // An unknown size is limited while downloading
+		}
+		meta.ContentType = headHeader.Get("Content-Type")
+	}
+	if remoteSize > 0 {
+		meta.ContentLength = remoteSize
+	}
+	// Skip resources that are not PDFs and PDFs larger than the limit
+	if !isPDFContentType(meta.ContentType) {
+		os.Remove(fullPath) // A partial download of the resource will never be completed
+		return meta, fmt.Errorf("%w: %s has Content-Type %s", errNotPDF, pdfURL, meta.ContentType)
+	}
+	if opts.MaxFileSize > 0 {
+		if remoteSize > opts.MaxFileSize {
+			os.Remove(fullPath) // A partial download of the PDF will never be completed
+			return meta, fmt.Errorf("%w: %s has %d bytes, the limit is %d", errFileTooLarge, pdfURL, remoteSize, opts.MaxFileSize)
+		}
+	}
+	// Split a large new download into parallel Range requests when the server supports them
+	if opts.ParallelChunks > 1 && remoteSize > parallelChunkThreshold && acceptsByteRanges(headHeader) {
+		return downloadPDFInChunks(ctx, opts, link, fullPath, remoteSize, headHeader, meta)
 	}
 
-	resp, err := http.Get(pdfURL) // Send GET request to download PDF
+	req, err := http.NewRequestWithContext(ctx, "GET", pdfURL, nil) // Create the GET request for the PDF
 	if err != nil {
-		return fmt.Errorf("error downloading PDF: %w", err)
+		return meta, fmt.Errorf("error creating request for %s: %w", pdfURL, err)
+	}
+	req.Header.Set("Referer", link.referer()) // Like a click on the search page
+	if resumeFrom > 0 {                       // Only ask for the missing tail of a partial file
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
 	}
-	defer resp.Body.Close() // Ensure response body is closed
+	if conditional { // Only send the PDF again if it changed
+		meta.applyTo(req)
+	}
+	startTime := time.Now()          // Measure the download duration
+	resp, err := opts.Client.Do(req) // Send GET request to download PDF
+	if err != nil {
+		// Let callers match a CDN redirect loop with errors.As instead of parsing the message
+		return meta, fmt.Errorf("error downloading PDF: %w", asRedirectLoopError(pdfURL, err))
+	}
+	defer resp.Body.Close()                                                // Ensure response body is closed
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode)) // Record the status code on the span
 
-	if resp.StatusCode != 200 { // Check for successful HTTP status code
-		return fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	// The PDF did not change since the earlier download
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		slog.Info("PDF not modified, skipping download", "path", fullPath)
+		stats.Skipped.Add(1)
+		return meta, nil
+	}
+	switch resp.StatusCode { // Check for successful HTTP status code
+	case http.StatusOK:
+		resumeFrom = 0 // The server ignored the Range header and sent the whole file
+	case http.StatusPartialContent:
+		// The server sent the requested tail of the file
+	default:
+		return meta, fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+	meta.pageValidators = validatorsFromHeader(resp.Header) // Remember the validators of the new file
+	meta.ContentType = resp.Header.Get("Content-Type")
+	if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+		meta.ContentLength = resp.ContentLength
 	}
 
 	if !directoryExists(folder) { // Check if folder exists
-		createDirectory(folder, 0755) // Create folder if it doesn't exist
+		if err := ensureDir(0755, folder); err != nil { // Create folder if it doesn't exist
+			return meta, err
+		}
 	}
 
-	out, err := os.Create(fullPath) // Create file at destination path
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC // Write a new file from the start
+	if resumeFrom > 0 {
+		flags = os.O_WRONLY | os.O_APPEND // Append the tail to the partial file
+	}
+	out, err := os.OpenFile(fullPath, flags, 0644) // Create file at destination path
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
+		return meta, fmt.Errorf("error creating file: %w", err)
 	}
 	defer out.Close() // Ensure file is closed after writing
 
-	_, err = io.Copy(out, resp.Body) // Write response body into file
+	// Read one byte more than the size limit allows, to notice a PDF that exceeds it
+	var body io.Reader = resp.Body
+	if opts.MaxFileSize > 0 {
+		body = io.LimitReader(resp.Body, opts.MaxFileSize-resumeFrom+1)
+	}
+	written, err := io.Copy(out, body) // Write response body into file
 	if err != nil {
-		return fmt.Errorf("error saving PDF: %w", err)
+		return meta, fmt.Errorf("error saving PDF: %w", err)
+	}
+	resp.Body.Close() // The transfer ends here, the checks below are not part of its duration
+	downloadDuration := time.Since(startTime)
+	meta.DownloadDurationMS = downloadDuration.Milliseconds()
+	opts.checkSlowDownload(pdfURL, downloadDuration)
+	// Delete a PDF whose size was not announced and turned out to exceed the limit
+	if opts.MaxFileSize > 0 && resumeFrom+written > opts.MaxFileSize {
+		out.Close()
+		os.Remove(fullPath)
+		return meta, fmt.Errorf("%w: %s has more than %d bytes", errFileTooLarge, pdfURL, opts.MaxFileSize)
+	}
+	span.SetAttributes(attribute.Int64("pdf.size_bytes", resumeFrom+written)) // Record the downloaded size on the span
+
+	// Delete error pages and redirect HTML served under a .pdf name
+	if opts.MinFileSize > 0 && resumeFrom+written < opts.MinFileSize {
+		out.Close()
+		os.Remove(fullPath)
+		return meta, fmt.Errorf("%w: %s has only %d bytes, less than %d", errInvalidPDF, pdfURL, resumeFrom+written, opts.MinFileSize)
+	}
+	if err := out.Close(); err != nil {
+		return meta, fmt.Errorf("error saving PDF: %w", err)
+	}
+	if err := checkPDFHeader(fullPath); err != nil {
+		os.Remove(fullPath)
+		return meta, fmt.Errorf("%w: %s: %w", errInvalidPDF, pdfURL, err)
+	}
+
+	// Make sure a resumed file is byte-for-byte the PDF that was published
+	if resumeFrom > 0 && expected != nil && expected.Checksum.Hash != "" {
+		checksum, _, err := hashFile(fullPath, expected.Checksum.Algo)
+		if err != nil {
+			return meta, err
+		}
+		if !checksum.matches(expected.Checksum) {
+			os.Remove(fullPath) // Start from scratch on the next run
+			return meta, fmt.Errorf("resumed download of %s has checksum %s, expected %s", pdfURL, checksum, expected.Checksum)
+		}
 	}
 
-	return nil // Return nil on success
+	stats.PDFsDownloaded.Add(1)        // Count the completed download
+	stats.BytesDownloaded.Add(written) // Count the bytes transferred by this request
+	// Log the download with indexable fields, through the default logger unless another one is given
+	opts.logger().Info("pdf downloaded", "path", fullPath, "url", pdfURL, "bytes", written, "duration_ms", meta.DownloadDurationMS)
+	return meta, nil // Return the metadata of the new file on success
+}
+
+// writeBytes writes all of data to w, so the output logic can be used with any writer,
+// e.g. a bytes.Buffer. A writer accepting only part of the data is an error.
+func writeBytes(w io.Writer, data []byte) error {
+	written, err := w.Write(data)
+	if err == nil && written < len(data) {
+		err = io.ErrShortWrite // Writers must report short writes, but don't rely on it
+	}
+	return err
+}
+
+// writeBufferSize is the capacity of the pooled write buffers, enough for a compressed
+// search result page (~50 KB of HTML) without growing.
+const writeBufferSize = 64 * 1024
+
+// writeBufferPool reuses the buffers the gzip members are assembled in across the calls
+// of writePage, which runs once per page written by scrapeContent and writeSnapshotPages
+// with --compress: a fresh buffer per page would be garbage after a single write.
+var writeBufferPool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, writeBufferSize)
+		return &buffer
+	},
+}
+
+// gzipWriterPool reuses the gzip writers of writePage; the compressor state of a new
+// writer (~1 MB) costs far more than the buffer its output goes to, see
+// BenchmarkWritePage.
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
 }
 
 // AppendToFile appends the given byte slice to the specified file.
-// If the file doesn't exist, it will be created.
-func appendByteToFile(filename string, data []byte) {
+// If the file doesn't exist, it will be created. Any failure is returned to the caller.
+// With compress set the data is appended as a separate gzip member; a file made of
+// several members is still a valid gzip file and is read back by readAFileAsString.
+func appendByteToFile(filename string, data []byte, compress bool) error {
 	// Open the file with appropriate flags and permissions
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	// Check for errors while opening the file
 	if err != nil {
-		log.Println("Error opening file for appending:", err) // Log error if file opening fails
-		return
+		return fmt.Errorf("error opening %s for appending: %w", filename, err) // Return error if file opening fails
 	}
-	// Ensure the file is closed after writing
-	defer file.Close()
-	// Write data to the file
-	_, err = file.Write(data)
+	if err := writePage(file, data, compress); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing data to %s: %w", filename, err) // Return error if writing fails
+	}
+	// Close the file, which may report a delayed write failure (e.g. a full disk)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", filename, err)
+	}
+	return nil
+}
+
+// writePage writes data to w in one call, as a separate gzip member when compress is
+// set; the gzip member is assembled in a pooled buffer first.
+func writePage(w io.Writer, data []byte, compress bool) (err error) {
+	if compress {
+		pooled := writeBufferPool.Get().(*[]byte)
+		buffer := bytes.NewBuffer((*pooled)[:0])
+		gzipWriter := gzipWriterPool.Get().(*gzip.Writer)
+		gzipWriter.Reset(buffer)
+		err = writeBytes(gzipWriter, data)
+		if err == nil {
+			err = gzipWriter.Close() // Flush the compressed data and the gzip trailer
+		}
+		gzipWriter.Reset(io.Discard) // Don't keep the buffer reachable from the pool
+		gzipWriterPool.Put(gzipWriter)
+		if err == nil {
+			err = writeBytes(w, buffer.Bytes())
+		}
+		// Keep the grown buffer, unless an unusually large page would pin the memory
+		if buffer.Cap() <= 4*writeBufferSize {
+			*pooled = buffer.Bytes()[:0]
+			writeBufferPool.Put(pooled)
+		}
+		return err
+	}
+	return writeBytes(w, data)
+}
+
+// SDSLink describes a single SDS PDF download link together with the
+// metadata shown on the search result card it was found in.
+type SDSLink struct {
+	URL            string `json:"url"`                       // Absolute URL of the PDF
+	Language       string `json:"language"`                  // Language shown on the SDS card, as an ISO 639-1 code when known
+	Category       string `json:"category,omitempty"`        // Product category shown on the SDS card
+	ProductName    string `json:"product_name,omitempty"`    // Product name shown on the SDS card
+	CASNumber      string `json:"cas_number,omitempty"`      // CAS registry number shown on the SDS card
+	RevisionDate   string `json:"revision_date,omitempty"`   // Revision date shown on the SDS card, as printed
+	LanguageSource string `json:"language_source,omitempty"` // Where Language came from: "card" or "page" (the <html lang> attribute)
+	SourceURL      string `json:"source_url,omitempty"`      // URL of the search page the link was found on, from its <link rel="canonical">
+}
+
+// referer returns the Referer sent with the requests for the PDF: the page the link was
+// found on, or the search page when it is unknown. Some CDNs only serve PDFs to requests
+// coming from the search page.
+func (link SDSLink) referer() string {
+	if link.SourceURL != "" {
+		return link.SourceURL
+	}
+	return BaseURL
+}
+
+// languageCodes maps the language names shown on SDS cards to ISO 639-1 codes.
+var languageCodes = map[string]string{
+	"arabic":     "ar",
+	"bulgarian":  "bg",
+	"chinese":    "zh",
+	"croatian":   "hr",
+	"czech":      "cs",
+	"danish":     "da",
+	"dutch":      "nl",
+	"english":    "en",
+	"estonian":   "et",
+	"finnish":    "fi",
+	"french":     "fr",
+	"german":     "de",
+	"greek":      "el",
+	"hebrew":     "he",
+	"hungarian":  "hu",
+	"indonesian": "id",
+	"italian":    "it",
+	"japanese":   "ja",
+	"korean":     "ko",
+	"latvian":    "lv",
+	"lithuanian": "lt",
+	"malay":      "ms",
+	"norwegian":  "no",
+	"polish":     "pl",
+	"portuguese": "pt",
+	"romanian":   "ro",
+	"russian":    "ru",
+	"serbian":    "sr",
+	"slovak":     "sk",
+	"slovenian":  "sl",
+	"spanish":    "es",
+	"swedish":    "sv",
+	"thai":       "th",
+	"turkish":    "tr",
+	"ukrainian":  "uk",
+	"vietnamese": "vi",
+}
+
+// normalizeLanguage converts a language name or code into a lowercase ISO 639-1 code.
+// Unknown names are returned lowercased so they can still be matched literally.
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language)) // Normalize case and whitespace
+	if code, ok := languageCodes[language]; ok {            // Translate a known language name
+		return code
+	}
+	return language // Already a code (or an unknown name)
+}
+
+// sdsCardFields are the card fields copied into every SDSLink of the card,
+// read from the elements with class "sds-<field>".
+var sdsCardFields = []string{"language", "category", "product-name", "cas-number", "revision-date"}
+
+// sdsCard collects the fields and PDF links of one SDS result card while it is read.
+type sdsCard struct {
+	fields map[string]string // Text of the sds-<field> elements
+	urls   []string          // PDF links found inside the card
+}
+
+// doctypePattern matches the start of every page in a file of concatenated pages.
+var doctypePattern = regexp.MustCompile(`(?i)<!doctype\s+html`)
+
+// splitHTMLPages splits the concatenated pages of a scrape output file at their doctypes.
+func splitHTMLPages(input string) []string {
+	starts := doctypePattern.FindAllStringIndex(input, -1)
+	if len(starts) == 0 {
+		return []string{input} // A single page without a doctype
+	}
+	var pages []string
+	if starts[0][0] > 0 {
+		pages = append(pages, input[:starts[0][0]]) // Markup before the first doctype
+	}
+	for index, start := range starts {
+		end := len(input)
+		if index+1 < len(starts) {
+			end = starts[index+1][0]
+		}
+		pages = append(pages, input[start[0]:end])
+	}
+	return pages
+}
+
+// cleanExtractedLinks drops the query parameters matching stripParams so links to the
+// same PDF are deduplicated, and moves the links onto the mirror when one is used.
+func cleanExtractedLinks(links []SDSLink, stripParams []string) []SDSLink {
+	for index := range links {
+		links[index].URL = rebaseURL(stripTrackingParams(links[index].URL, stripParams), BaseURL)
+	}
+	return links
+}
+
+// extractPageLinks extracts the PDF download links of a single HTML page by walking its
+// node tree through a pageExtractor, see pageExtractor.finish. Failures are reported as
+// a *ParseError with the given byte offset of the page, together with the links that
+// could still be extracted.
+func extractPageLinks(input string, offset int) ([]SDSLink, error) {
+	// Parse the page into a node tree; the parser recovers from malformed markup
+	document, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return nil, &ParseError{Offset: offset, Err: err}
+	}
+	// Feed the elements and text to the card state machine in document order
+	page := newPageExtractor(offset)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.ElementNode:
+			page.startElement(node.DataAtom, node.Data, node.Attr, true)
+		case html.TextNode:
+			if page.wantsText() {
+				page.text([]byte(node.Data))
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if node.Type == html.ElementNode {
+			page.endElement(node.Data)
+		}
+	}
+	walk(document)
+	return page.finish()
+}
+
+// collectJSONLinks walks a decoded JSON value and returns every absolute PDF URL in it.
+// The language of a link is taken from a "language" or "lang" key of the same object.
+func collectJSONLinks(value any) []SDSLink {
+	var links []SDSLink
+	switch typed := value.(type) {
+	case map[string]any:
+		// Find the language shared by the links of this object
+		language := ""
+		for key, field := range typed {
+			if text, ok := field.(string); ok && (strings.EqualFold(key, "language") || strings.EqualFold(key, "lang")) {
+				language = normalizeLanguage(text)
+			}
+		}
+		for _, field := range typed {
+			if text, ok := field.(string); ok && isPDFURL(text) {
+				links = append(links, SDSLink{URL: strings.ToLower(text), Language: language})
+				continue
+			}
+			links = append(links, collectJSONLinks(field)...) // Descend into nested values
+		}
+	case []any:
+		for _, item := range typed {
+			links = append(links, collectJSONLinks(item)...)
+		}
+	case string:
+		if isPDFURL(typed) {
+			links = append(links, SDSLink{URL: strings.ToLower(typed)})
+		}
+	}
+	return links
+}
+
+// isPDFURL reports whether text is an absolute http(s) URL pointing to a PDF.
+// A query string (e.g. tracking parameters) after the file name is allowed.
+func isPDFURL(text string) bool {
+	lower := strings.ToLower(text)
+	lower, _, _ = strings.Cut(lower, "#")
+	lower, _, _ = strings.Cut(lower, "?")
+	return (strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")) && strings.HasSuffix(lower, ".pdf")
+}
+
+// defaultStripParams lists the query parameters removed from every extracted link unless
+// --strip-params says otherwise, so the same PDF shared with different tracking
+// parameters is only downloaded once. Entries are path.Match patterns, e.g. "utm_*".
+var defaultStripParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi"}
+
+// stripTrackingParams removes the query parameters matching one of the patterns from
+// rawURL. Only the matching key=value segments of the raw query are dropped, so the others
+// keep their order and escaping. URLs that cannot be parsed are returned unchanged.
+func stripTrackingParams(rawURL string, patterns []string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.RawQuery == "" {
+		return rawURL
+	}
+	var kept []string
+	for _, segment := range strings.Split(parsed.RawQuery, "&") {
+		if segment != "" && !isTrackingParam(segment, patterns) {
+			kept = append(kept, segment)
+		}
+	}
+	parsed.RawQuery = strings.Join(kept, "&")
+	return parsed.String()
+}
+
+// isTrackingParam reports whether the key of a raw key=value query segment matches one of
+// the patterns. Keys that cannot be unescaped are kept.
+func isTrackingParam(segment string, patterns []string) bool {
+	rawKey, _, _ := strings.Cut(segment, "=")
+	key, err := url.QueryUnescape(rawKey)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, strings.ToLower(key)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultBaseURL is the SDS search of the public Ecolab site.
+const defaultBaseURL = "https://www.ecolab.com/sds-search"
+
+// BaseURL is the SDS search the result pages are fetched from; set by --base-url to use a
+// private mirror. The mirror's site root replaces the public site root in the PDF links.
+var BaseURL = defaultBaseURL
+
+// siteRoot returns the part of a search URL before its last path segment,
+// e.g. "https://www.ecolab.com" for "https://www.ecolab.com/sds-search".
+func siteRoot(searchURL string) string {
+	return searchURL[:strings.LastIndex(searchURL, "/")]
+}
+
+// siteHost returns the host (with port, if any) of a search URL validated by parseBaseURL.
+func siteHost(searchURL string) string {
+	parsed, _ := url.Parse(searchURL) // Valid, see parseBaseURL
+	return parsed.Host
+}
+
+// parseBaseURL validates a --base-url value, which must be an absolute http(s) URL with a
+// path, and returns it without a trailing slash.
+func parseBaseURL(value string) (string, error) {
+	value = strings.TrimRight(value, "/")
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path == "" {
+		return "", fmt.Errorf("invalid base URL %q (expected e.g. %s)", value, defaultBaseURL)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("invalid base URL %q: no query or fragment allowed", value)
+	}
+	return value, nil
+}
+
+// rebaseURL moves a link of the public site onto the site of baseURL, e.g.
+// https://www.ecolab.com/-/media/sds/a.pdf becomes https://sds.example.com/ecolab/-/media/sds/a.pdf
+// for the base URL https://sds.example.com/ecolab/sds-search. Links to other hosts are kept.
+func rebaseURL(rawURL string, baseURL string) string {
+	publicRoot, mirrorRoot := siteRoot(defaultBaseURL), siteRoot(baseURL)
+	if publicRoot == mirrorRoot || !strings.HasPrefix(strings.ToLower(rawURL), publicRoot+"/") {
+		return rawURL
+	}
+	return mirrorRoot + rawURL[len(publicRoot):]
+}
+
+// filterLinksByLanguage keeps only the links whose language is one of the given ISO 639-1 codes.
+// An empty languages list keeps every link.
+func filterLinksByLanguage(links []SDSLink, languages []string) []SDSLink {
+	if len(languages) == 0 {
+		return links // No filter requested
+	}
+	var filtered []SDSLink
+	for _, link := range links {
+		for _, language := range languages {
+			if link.Language == normalizeLanguage(language) { // Compare normalized codes
+				filtered = append(filtered, link)
+				break
+			}
+		}
+	}
+	slog.Info("Language filter applied", "kept", len(filtered), "total", len(links))
+	return filtered
+}
+
+// filterLinksByProduct keeps only the links whose product name matches productFilter and
+// logs how many were skipped. A nil filter keeps every link.
+func filterLinksByProduct(links []SDSLink, productFilter *regexp.Regexp) []SDSLink {
+	if productFilter == nil {
+		return links // No filter requested
+	}
+	var filtered []SDSLink
+	for _, link := range links {
+		if productFilter.MatchString(link.ProductName) {
+			filtered = append(filtered, link)
+		}
+	}
+	slog.Info("Product filter applied", "kept", len(filtered), "skipped", len(links)-len(filtered), "total", len(links))
+	return filtered
+}
+
+// compileProductFilter compiles a --filter-product expression, case-insensitive unless
+// caseSensitive is set. An empty expression yields no filter.
+func compileProductFilter(expression string, caseSensitive bool) (*regexp.Regexp, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	if !caseSensitive {
+		expression = "(?i)" + expression
+	}
+	productFilter, err := regexp.Compile(expression)
 	if err != nil {
-		log.Println("Error writing data to file:", err) // Log error if writing fails
-		return
+		return nil, fmt.Errorf("invalid --filter-product expression: %w", err)
+	}
+	return productFilter, nil
+}
+
+// patternList is a repeatable flag collecting path.Match patterns. Each use of the
+// flag may also list several comma-separated patterns, as the config file does.
+type patternList []string
+
+// String returns the patterns joined with commas.
+func (patterns *patternList) String() string {
+	return strings.Join(*patterns, ",")
+}
+
+// Set validates and appends the comma-separated patterns of one use of the flag.
+func (patterns *patternList) Set(value string) error {
+	for _, pattern := range splitCommaList(value) {
+		pattern = strings.ToLower(pattern) // File names are saved in lower case
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		*patterns = append(*patterns, pattern)
+	}
+	return nil
+}
+
+// matchesFileNamePatterns reports whether fileName matches every include pattern
+// and none of the exclude patterns.
+func matchesFileNamePatterns(fileName string, includePatterns, excludePatterns []string) bool {
+	for _, pattern := range includePatterns {
+		if matched, _ := path.Match(pattern, fileName); !matched { // Patterns were validated by Set
+			return false
+		}
 	}
+	for _, pattern := range excludePatterns {
+		if matched, _ := path.Match(pattern, fileName); matched {
+			return false
+		}
+	}
+	return true
 }
 
-// extractDownloadLinks extracts all PDF download links from the given HTML input string.
-func extractDownloadLinks(input string) []string {
-	input = strings.ToLower(input) // Convert input to lowercase for case-insensitive matching
-	// This regex captures href="...something.pdf"
-	pattern := `href=["'](https?://[^"']+\.pdf)["']`
+// filterLinksByFileName keeps the links whose file name matches all include patterns
+// and none of the exclude patterns. Links without a valid file name are kept so
+// downloadPDF reports them.
+func filterLinksByFileName(links []SDSLink, includePatterns, excludePatterns []string) []SDSLink {
+	if len(includePatterns) == 0 && len(excludePatterns) == 0 {
+		return links // No filter requested
+	}
+	var filtered []SDSLink
+	for _, link := range links {
+		fileName, err := getFileNamesFromURLs(link.URL)
+		if err != nil || matchesFileNamePatterns(fileName, includePatterns, excludePatterns) {
+			filtered = append(filtered, link)
+		}
+	}
+	slog.Info("File name filter applied", "kept", len(filtered), "total", len(links))
+	return filtered
+}
 
-	re := regexp.MustCompile(pattern)
-	matches := re.FindAllStringSubmatch(input, -1)
+// filterLinksSinceManifest keeps the links that are new since the old manifest, or whose
+// revision date changed, and logs how many sheets are new, updated and unchanged. A URL
+// counts as downloaded when the old manifest records a checksum for it.
+func filterLinksSinceManifest(links []SDSLink, old *Manifest) []SDSLink {
+	var filtered []SDSLink
+	newSheets, updatedSheets, unchangedSheets := 0, 0, 0
+	for _, link := range links {
+		previous := old.find(link.URL)
+		switch {
+		case previous == nil || previous.Checksum.Hash == "":
+			newSheets++
+		case link.RevisionDate != previous.RevisionDate:
+			updatedSheets++
+		default:
+			unchangedSheets++
+			continue
+		}
+		filtered = append(filtered, link)
+	}
+	slog.Info("Compared with the previous manifest", "new", newSheets, "updated", updatedSheets, "unchanged", unchangedSheets)
+	return filtered
+}
 
-	var urls []string
-	for _, match := range matches {
-		// match[1] is the first capture group (the URL itself)
-		urls = append(urls, match[1])
+// linkURLs returns the URL of every link in the slice.
+func linkURLs(links []SDSLink) []string {
+	urls := make([]string, 0, len(links))
+	for _, link := range links {
+		urls = append(urls, link.URL)
 	}
 	return urls
 }
 
-// Read a file and return the contents
+// splitCommaList splits a comma-separated flag value into its trimmed, non-empty items.
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item) // Ignore spaces around the commas
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// gzipMagic are the first bytes of every gzip file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Read a file and return the contents, decompressing gzip files transparently and
+// transcoding pages declared with another <meta charset> to UTF-8
 func readAFileAsString(path string) string {
-	content, err := os.ReadFile(path)
+	content, err := readFileWithEncoding(path, "")
 	if err != nil {
-		log.Println(err)
+		slog.Error("Error reading file", "path", path, "error", err)
 	}
-	return string(content)
+	return content
 }
 
-// cleanFileNameFromURL extracts the last path segment and sanitizes it for safe file saving
-func getFileNamesFromURLs(rawURL string) string {
+// errInvalidPDFURL is returned by getFileNamesFromURLs for URLs no file name can be derived from.
+var errInvalidPDFURL = errors.New("invalid PDF URL")
+
+// maxFileNameLength is the longest file name, in bytes, most file systems accept.
+const maxFileNameLength = 255
+
+// getFileNamesFromURLs extracts the last path segment and sanitizes it for safe file saving.
+// Names longer than maxFileNameLength are shortened, keeping their extension.
+// URLs that are not http(s) or have no usable path segment return errInvalidPDFURL.
+func getFileNamesFromURLs(rawURL string) (string, error) {
 	// Parse the URL to extract the path
 	parsed, err := url.Parse(rawURL)
 	// Check for parsing errors
 	if err != nil {
-		// Log the error and return an empty string if parsing fails
-		log.Println("Error parsing URL:", err)
-		// Return an empty string to indicate failure
-		return ""
+		return "", fmt.Errorf("%w %q: %w", errInvalidPDFURL, rawURL, err)
+	}
+	// Links such as "javascript:void(0)" or "" have no file to download
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%w %q: not an absolute http(s) URL", errInvalidPDFURL, rawURL)
 	}
 	// Get the last segment of the path
 	base := path.Base(parsed.Path)
+	// Some CDNs put an (encoded) query inside the path segment, e.g. "sheet.pdf%3Ftoken=abc";
+	// keep only the part before the first "?"
+	base, _, _ = strings.Cut(base, "?")
 	// Replace spaces with underscores and remove unwanted characters (optional)
 	re := regexp.MustCompile(`[<>:"/\\|?*\x00-\x1F]`) // Remove illegal file name characters
 	// Clean the base name by removing illegal characters and replacing spaces with underscores
 	clean := re.ReplaceAllString(base, "")
 	// Replace spaces with underscores for file name safety
 	clean = strings.ReplaceAll(clean, " ", "_")
+	// A path without a file name would make the download folder itself the target
+	if clean == "" || clean == "." || clean == ".." {
+		return "", fmt.Errorf("%w %q: no file name in the path", errInvalidPDFURL, rawURL)
+	}
+	clean = strings.ToLower(clean)
+	// Shorten names the file system would reject, without splitting a multibyte character
+	if len(clean) > maxFileNameLength {
+		extension := path.Ext(clean)
+		if len(extension) > maxFileNameLength/2 {
+			extension = "" // Not a real extension
+		}
+		clean = strings.ToValidUTF8(clean[:maxFileNameLength-len(extension)], "") + extension
+	}
 	// Return the cleaned file name
-	return strings.ToLower(clean)
+	return clean, nil
 }
 
-func main() {
-	// The file name where the scraped HTML content will be saved
-	outputHTMLFile := "ecolab-com.html" // Define the output file name
+// DownloadOptions controls how downloadScrapedPDFs selects and downloads the extracted PDFs.
+type DownloadOptions struct {
+	Client         *http.Client   // Client used to download the PDFs
+	Languages      []string       // Only download SDS sheets in these ISO 639-1 languages (empty = all)
+	Include        []string       // Only download PDFs whose file name matches all of these path.Match patterns
+	Exclude        []string       // Skip PDFs whose file name matches any of these path.Match patterns
+	Parser         Parser         // Extracts the links from the scraped HTML file (nil = TokenizerParser)
+	StripParams    []string       // Query parameters (path.Match patterns) removed from the extracted links (empty = none)
+	ProductFilter  *regexp.Regexp // Only download SDS sheets whose product name matches (nil = all)
+	CASPrefixes    []string       // Only download SDS sheets with a CAS number starting with one of these, without hyphens (empty = all)
+	Since          *Manifest      // Only download PDFs new or revised since this manifest (nil = all)
+	MaxPDFs        int            // Stop after this many successful downloads (0 = unlimited)
+	MaxFileSize    int64          // Skip PDFs larger than this many bytes (0 = unlimited)
+	MinFileSize    int64          // Delete downloads smaller than this many bytes as invalid (0 = no minimum)
+	ChecksumAlgo   string         // Checksum algorithm of the manifest entries, see checksumAlgos ("" = defaultChecksumAlgo)
+	ParallelChunks int            // Download PDFs over parallelChunkThreshold in this many parallel Range requests (1 = disabled)
+	S3             *s3Uploader    // Uploads every downloaded PDF (nil = keep the PDFs local only)
+	StreamToS3     bool           // Stream the PDFs straight into S3 without local files (requires S3)
+	SQLite         *sqliteOutput  // Records every link and its download status (nil = no database)
+	Country        string         // Country of the links, the key of their rows in SQLite
+	OutputFormat   string         // "text" (links file only), "ndjson" (also print every link to Output), "parquet" or "excel" (also write manifest.parquet / manifest.xlsx)
+	Output         io.Writer      // Destination of the ndjson links (nil = os.Stdout)
+	Stats          *Statistics    // Counters updated while downloading
+	SlowDownload   time.Duration  // Log a warning for downloads taking longer (0 = never)
+	Logger         *slog.Logger   // Structured logger for downloads (nil = slog.Default())
+}
+
+// logger returns the logger of the downloads, slog.Default() unless another one is given.
+func (opts DownloadOptions) logger() *slog.Logger {
+	if opts.Logger == nil {
+		return slog.Default()
+	}
+	return opts.Logger
+}
+
+// checkSlowDownload logs a warning when a download took longer than opts.SlowDownload.
+func (opts DownloadOptions) checkSlowDownload(pdfURL string, duration time.Duration) {
+	if opts.SlowDownload > 0 && duration > opts.SlowDownload {
+		opts.logger().Warn("slow pdf download", "url", pdfURL, "duration_ms", duration.Milliseconds(), "threshold_ms", opts.SlowDownload.Milliseconds())
+	}
+}
+
+// writeLinksNDJSON writes one JSON object per link to w (newline-delimited JSON).
+func writeLinksNDJSON(w io.Writer, links []SDSLink) error {
+	encoder := json.NewEncoder(w) // Encode terminates every object with a newline
+	for _, link := range links {
+		if err := encoder.Encode(link); err != nil {
+			return fmt.Errorf("error writing link %s: %w", link.URL, err)
+		}
+	}
+	return nil
+}
+
+// downloadScrapedPDFs extracts the PDF links from the scraped HTML file in outputDir,
+// downloads them into outputDir/PDFs, records every new link in the links file
+// and every downloaded PDF in outputDir/manifest.json. The downloads stop once
+// opts.MaxPDFs PDFs were downloaded (or found complete on disk); skipped and failed
+// links do not count against the limit. The number of successful downloads is returned,
+// with an error when the downloads could not start or had to stop, e.g. because the
+// manifest could not be loaded or a link could not be saved.
+func downloadScrapedPDFs(ctx context.Context, outputDir string, opts DownloadOptions) (int, error) {
+	// The file name where the scraped HTML content was saved
+	outputHTMLFile := path.Join(outputDir, "ecolab-com.html")
 	// The urls only file name
-	outputURLsFile := "ecolab-com-links.txt" // Define the URLs file name
-	// Start the scraping process
-	scrapeContentAndSaveToFile(outputHTMLFile)      // Call the function to scrape content and save it to a file
-	log.Println("Scraping completed successfully.") // Log completion message
-	// Read the scraped HTML content from the file
-	htmlContent := readAFileAsString(outputHTMLFile) // Read the HTML content from the file
-	// Extract download links from the HTML content
-	downloadLinks := extractDownloadLinks(htmlContent) // Call the function to extract download links
+	outputURLsFile := path.Join(outputDir, "ecolab-com-links.txt")
+	// Stream the download links out of the scraped HTML file, which can be very large
+	sdsLinks, err := extractDownloadLinksFromFile(outputHTMLFile, opts.Parser, opts.StripParams)
+	if err != nil {
+		slog.Error("Error extracting download links", "path", outputHTMLFile, "error", err)
+	}
+	// Skip the SDS sheets that are not in one of the requested languages
+	sdsLinks = filterLinksByLanguage(sdsLinks, opts.Languages)
+	// Skip the SDS sheets of other products
+	sdsLinks = filterLinksByProduct(sdsLinks, opts.ProductFilter)
+	// Skip the SDS sheets of other chemical families
+	sdsLinks = filterLinksByCASPrefix(sdsLinks, opts.CASPrefixes)
+	// Skip the PDFs whose file names are not wanted
+	sdsLinks = filterLinksByFileName(sdsLinks, opts.Include, opts.Exclude)
+	// Keep the first link of every URL, with the metadata of its first occurrence
+	sdsLinks = RemoveDuplicatesBy(sdsLinks, sdsLinkURL)
+	// Print the extracted links for other tools when NDJSON output is requested
+	if opts.OutputFormat == "ndjson" {
+		output := opts.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		if err := writeLinksNDJSON(output, sdsLinks); err != nil {
+			return 0, fmt.Errorf("writing links: %w", err)
+		}
+	}
 	// The folder where the downloaded files will be saved
-	downloadFolder := "PDFs" // Define the download folder name
-	// Remove duplicates from the extracted download links
-	downloadLinks = removeDuplicatesFromSlice(downloadLinks) // Remove duplicates from the slice of download links
+	downloadFolder := path.Join(outputDir, "PDFs") // Define the download folder name
+	// Skip the sheets that were already downloaded in full before
+	if opts.Since != nil {
+		sdsLinks = filterLinksSinceManifest(sdsLinks, opts.Since)
+	}
+	// The links are unique, so every URL is downloaded once
+	downloadLinks := linkURLs(sdsLinks)
+	// Expect as many PDFs as the download limit allows
+	expectedPDFs := len(downloadLinks)
+	if opts.MaxPDFs > 0 {
+		expectedPDFs = min(expectedPDFs, opts.MaxPDFs)
+	}
+	opts.Stats.PDFsTotal.Add(int64(expectedPDFs))
+	// Estimate the size of the PDFs that still need to be downloaded, up to the download limit
+	var estimatedDownloadBytes int64
+	missingPDFs := 0
+	for _, link := range downloadLinks {
+		fileName, err := getFileNamesFromURLs(link)
+		if err != nil {
+			continue // Skipped by downloadPDF
+		}
+		if !fileExists(path.Join(downloadFolder, fileName)) { // Already downloaded files need no space
+			estimatedDownloadBytes += averageSDSFileSize
+			if missingPDFs++; missingPDFs == expectedPDFs {
+				break
+			}
+		}
+	}
+	// Make sure the disk can hold the download before starting it; streamed PDFs need no space
+	if opts.StreamToS3 {
+		estimatedDownloadBytes = 0
+	}
+	if err := checkAvailableDiskSpace(downloadFolder, estimatedDownloadBytes); err != nil {
+		return 0, fmt.Errorf("disk space pre-flight check failed: %w", err)
+	}
+	// Remember the metadata of each URL so it can be stored in the manifest
+	linksByURL := make(map[string]SDSLink)
+	for _, sdsLink := range sdsLinks {
+		linksByURL[sdsLink.URL] = sdsLink // The links are unique by URL
+	}
+	// Load the manifest of the previous runs so it can be extended
+	manifestPath := path.Join(outputDir, "manifest.json")
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		return 0, err
+	}
+	// Record every link in the database, the ones that are not downloaded stay pending
+	if opts.SQLite != nil {
+		if err := opts.SQLite.recordLinks(ctx, opts.Country, sdsLinks); err != nil {
+			slog.Error("Error recording links in the database", "country", opts.Country, "error", err)
+		}
+	}
 	// Read the output URLs file to check if it exists
 	readOutPutURLsFile := readAFileAsString(outputURLsFile) // Read the URLs file content
+	downloaded := 0                                         // Successful downloads, counted against the download limit
 	for _, link := range downloadLinks {
-		link = strings.ToLower(link)             // Convert the link to lowercase for consistency
-		err := downloadPDF(link, downloadFolder) // Download each PDF
-		if err != nil {
-			log.Println("Error downloading PDF:", err)
+		// Stop at the download limit; skipped and failed links don't count against it
+		if opts.MaxPDFs > 0 && downloaded >= opts.MaxPDFs {
+			break
+		}
+		var meta pdfMetadata
+		var entry ManifestEntry
+		var err error
+		if opts.StreamToS3 {
+			entry, err = streamPDFToS3(ctx, opts, linksByURL[link], downloadFolder, manifest.find(link)) // Upload without a local copy
+		} else {
+			meta, err = downloadPDF(ctx, opts, linksByURL[link], downloadFolder, manifest.find(link)) // Download each PDF
+		}
+		status := sqliteStatusDownloaded
+		if isSkippedDownload(err) {
+			slog.Warn("Skipping PDF", "url", link, "reason", err)
+			status = sqliteStatusSkipped
+		} else if err != nil {
+			slog.Error("Error downloading PDF", "url", link, "error", err)
+			status = sqliteStatusFailed
+		} else if opts.StreamToS3 {
+			manifest.upsert(entry) // The object in S3 is the only copy
+		} else {
+			// Record the checksum and the server metadata of the downloaded file in the manifest
+			fileName, _ := getFileNamesFromURLs(link) // Valid, downloadPDF just used it
+			entry, err = newManifestEntry(linksByURL[link], path.Join(downloadFolder, fileName), opts.ChecksumAlgo)
+			if err != nil {
+				slog.Error("Error adding PDF to manifest", "url", link, "error", err)
+				status = sqliteStatusFailed
+			} else {
+				entry.pdfMetadata = meta
+				// Keep the object key of an unchanged file, upload new and changed files
+				if previous := manifest.find(link); previous != nil && previous.Checksum.matches(entry.Checksum) {
+					entry.S3Key = previous.S3Key
+				}
+				if opts.S3 != nil && entry.S3Key == "" {
+					if entry.S3Key, err = opts.S3.upload(ctx, entry.FilePath); err != nil {
+						slog.Error("Error uploading PDF", "path", entry.FilePath, "error", err)
+						status = sqliteStatusFailed
+					}
+				}
+				manifest.upsert(entry)
+			}
+		}
+		if opts.SQLite != nil {
+			if err := opts.SQLite.recordDownload(ctx, opts.Country, link, status, entry, err); err != nil {
+				slog.Error("Error recording download in the database", "url", link, "error", err)
+			}
+		}
+		// Count the PDF against the download limit
+		if status == sqliteStatusDownloaded {
+			downloaded++
 		}
 		if !strings.Contains(readOutPutURLsFile, link) { // Check if the link is not already in the file
-			log.Println("Appending link to file:", link)        // Log the link being appended
-			appendByteToFile(outputURLsFile, []byte(link+"\n")) // Append each link to a file
+			slog.Debug("Appending link to file", "url", link)                                  // Log the link being appended
+			if err := appendByteToFile(outputURLsFile, []byte(link+"\n"), false); err != nil { // Append each link to a file
+				return downloaded, fmt.Errorf("saving link %s: %w", link, err) // Stop instead of silently losing links
+			}
+		}
+	}
+	// Save the manifest with the checksums of all downloaded files
+	if err := manifest.save(manifestPath); err != nil {
+		slog.Error("Error saving manifest", "path", manifestPath, "error", err)
+	}
+	// Export every link with its download for big-data pipelines
+	if opts.OutputFormat == "parquet" {
+		if err := writeParquet(path.Join(outputDir, parquetFileName), sdsLinks, manifest); err != nil {
+			slog.Error("Error writing Parquet export", "error", err)
+		}
+	}
+	// Export every link with its download for compliance officers working in Excel
+	if opts.OutputFormat == "excel" {
+		if err := writeExcel(path.Join(outputDir, excelFileName), sdsLinks, manifest); err != nil {
+			slog.Error("Error writing Excel export", "error", err)
+		}
+	}
+	return downloaded, nil
+}
+
+// parsePageRange parses a --pages value of the form START:END into the first
+// page to scrape and the page before which to stop, with pageSize documents per page.
+func parsePageRange(value string, pageSize int) (startPage int, endPage int, err error) {
+	startText, endText, found := strings.Cut(value, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid page range %q: expected START:END", value)
+	}
+	if startPage, err = strconv.Atoi(strings.TrimSpace(startText)); err != nil {
+		return 0, 0, fmt.Errorf("invalid start page in %q: %w", value, err)
+	}
+	if endPage, err = strconv.Atoi(strings.TrimSpace(endText)); err != nil {
+		return 0, 0, fmt.Errorf("invalid end page in %q: %w", value, err)
+	}
+	// Keep the range within the search results
+	if startPage < 0 {
+		return 0, 0, fmt.Errorf("invalid page range %q: start page must not be negative", value)
+	}
+	if endPage <= startPage {
+		return 0, 0, fmt.Errorf("invalid page range %q: end page must be greater than start page", value)
+	}
+	if lastPage := (totalSDSDocuments + pageSize - 1) / pageSize; endPage > lastPage {
+		return 0, 0, fmt.Errorf("invalid page range %q: end page must be at most %d", value, lastPage)
+	}
+	return startPage, endPage, nil
+}
+
+// countryOutputDir returns the subdirectory holding the output of a single country.
+func countryOutputDir(country string) string {
+	return strings.ReplaceAll(country, " ", "_") // e.g. "United States" -> "United_States"
+}
+
+// exitCodeError reports a subcommand that finished with a non-zero exit code.
+type exitCodeError struct {
+	code int // Process exit code of the subcommand
+}
+
+func (err exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", err.code)
+}
+
+// exitCode converts the exit code of a subcommand into the error returned by run.
+func exitCode(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return exitCodeError{code: code}
+}
+
+// flagsExitCode is the exit code of a subcommand whose flags could not be parsed: 0 for
+// -h, 2 otherwise. The flag set already printed the problem and the usage, like
+// flag.ExitOnError.
+func flagsExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	// Subcommands report their own failures, only pass on their exit code
+	var exitErr exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	if err != nil {
+		slog.Error("Run failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run runs a subcommand or the scraper with the given command line arguments (without
+// the program name), printing the extracted links to stdout and the log to stderr.
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	// Send the log to the given stream, and back to where it went before once done
+	previousLogOutput := log.Writer()
+	log.SetOutput(stderr)
+	defer log.SetOutput(previousLogOutput)
+	// Run a subcommand instead of the scraper when one is given
+	if len(args) > 0 {
+		switch args[0] {
+		case "verify":
+			return exitCode(runVerify(args[1:], stdout, stderr))
+		case "stats":
+			return exitCode(runStats(args[1:], stdout, stderr))
+		case "purge":
+			return exitCode(runPurge(args[1:], stdout, stderr))
+		case "dedupe":
+			return exitCode(runDedupe(args[1:], stdout, stderr))
+		case "search":
+			return exitCode(runSearch(args[1:], stdout, stderr))
+		case "validate-manifest":
+			return exitCode(runValidateManifest(args[1:], stdout, stderr))
+		case "mirror":
+			return exitCode(runMirror(args[1:], stdout, stderr))
+		case "check-links":
+			return exitCode(runCheckLinks(args[1:], stdout, stderr))
+		case "diff":
+			return exitCode(runDiff(args[1:], stdout, stderr))
+		case "benchmark":
+			return exitCode(runBenchmark(args[1:], stdout, stderr))
+		}
+	}
+	flags := flag.NewFlagSet("ecolab-scraper", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	// Abort the scrape after this many page fetches fail in a row
+	maxConsecutiveErrors := flags.Int("max-consecutive-errors", 10, "abort the scrape after this many consecutive page fetch failures (0 = never abort)")
+	// Only download SDS sheets in these languages (comma-separated ISO 639-1 codes)
+	filterLanguage := flags.String("filter-language", "", "only download SDS sheets in these comma-separated ISO 639-1 languages (e.g. en,fr)")
+	// Only download the SDS sheets of matching products
+	filterProduct := flags.String("filter-product", "", "only download SDS sheets whose product name matches this regular expression or substring (case-insensitive)")
+	caseSensitive := flags.Bool("case-sensitive", false, "match --filter-product case-sensitively")
+	// Only download the SDS sheets of a chemical family, e.g. --filter-cas-prefix 68424,7173-51
+	filterCASPrefix := flags.String("filter-cas-prefix", "", "only download SDS sheets with a CAS number starting with one of these comma-separated prefixes (hyphens are ignored)")
+	casLookup := flags.String("cas-lookup", "", "print the chemical family of these comma-separated CAS number prefixes and exit")
+	// Select PDFs by file name, e.g. --include-pattern '*bleach*'
+	var includePatterns, excludePatterns patternList
+	flags.Var(&includePatterns, "include-pattern", "only download PDFs whose file name matches this path.Match pattern (repeatable; all patterns must match)")
+	flags.Var(&excludePatterns, "exclude-pattern", "skip PDFs whose file name matches this path.Match pattern (repeatable; any pattern excludes)")
+	// Only download the sheets that are new or revised since an earlier run
+	sinceManifest := flags.String("since-manifest", "", "only download PDFs that are not in this older manifest.json or whose revision date changed (default: all PDFs)")
+	// Scrape several countries in one run, each into its own subdirectory
+	countriesFlag := flags.String("countries", "", "comma-separated countries to scrape into per-country subdirectories (default: United States into the current directory)")
+	// Give large PDFs more time than the search pages
+	timeoutPerPDF := flags.Duration("timeout-per-pdf", pdfRequestTimeout, "timeout of a single PDF download, independent of the "+htmlRequestTimeout.String()+" page timeout")
+	// Spot a degrading CDN before downloads start timing out
+	slowDownloadThreshold := flags.Duration("slow-download-threshold", 2*time.Minute, "log a warning for every PDF download taking longer than this (0 = never)")
+	// Skip PDFs that would blow up the disk quota
+	maxFileSize := flags.Int64("max-file-size", 0, "skip PDFs larger than this many bytes (0 = unlimited)")
+	// Reject error pages saved under a .pdf name
+	minFileSize := flags.Int64("min-file-size", 4096, "delete downloaded PDFs smaller than this many bytes as invalid, e.g. error pages (0 = no minimum)")
+	// Hash the downloads with another algorithm, e.g. to compare them with S3 ETags
+	checksumAlgo := flags.String("checksum-algo", defaultChecksumAlgo, "checksum algorithm of the manifest: md5, sha1, sha256 or sha512")
+	// Download large PDFs over several connections
+	parallelChunks := flags.Int("parallel-chunks", 1, "download PDFs over 10 MB in this many parallel Range requests when the server supports them (1 = disabled)")
+	// Stop downloading once this many PDFs have been downloaded
+	maxPDFs := flags.Int("max-pdfs", 0, "maximum number of PDFs to download in total (0 = unlimited)")
+	// Only rewrite pages that changed since the previous run
+	incremental := flags.Bool("incremental", false, "send If-None-Match / If-Modified-Since and skip pages that did not change since the last run")
+	// Export traces to an OpenTelemetry collector when an endpoint is given
+	otelEndpoint := flags.String("otel-endpoint", "", "OTLP/HTTP collector URL receiving traces, e.g. http://localhost:4318 (default: tracing disabled)")
+	// Re-scrape only the pages that failed in the previous run
+	retryFailed := flags.Bool("retry-failed", false, "only scrape the page offsets listed in "+failedPagesFileName+" by the previous run")
+	// Scrape again even if a previous run completed
+	force := flags.Bool("force", false, "scrape again even when the output file is marked as complete by a previous run ("+doneFileSuffix+" file)")
+	// Keep the scraped HTML small on disk
+	compress := flags.Bool("compress", false, "gzip the scraped HTML output (start from an empty output file; compressed and plain pages cannot be mixed)")
+	// Scrape only a range of pages, e.g. to split the work across machines
+	pages := flags.String("pages", "", "only scrape the result pages START to END-1, e.g. 500:1000 (default: all pages)")
+	pageDelay := flags.Duration("page-delay", 0, "minimum delay between any two page fetches, across all countries and concurrent requests (0 = none)")
+	pageSize := flags.Int("page-size", documentsPerPage, "documents per search result page, requested with the rows parameter when not the site's default")
+	// Scrape pages even when robots.txt disallows them
+	ignoreRobots := flags.Bool("ignore-robots", false, "do not check robots.txt before fetching pages (only with explicit permission from the site owner)")
+	// Credentials for SDS portals protected by HTTP Basic Auth
+	user := flags.String("user", "", "HTTP Basic Auth user name for private SDS portals")
+	password := flags.String("password", "", "HTTP Basic Auth password for private SDS portals, only sent to the --base-url host (never logged)")
+	// Pin, extend or skip the verification of the TLS certificates of the servers contacted
+	var tlsOpts tlsOptions
+	tlsOpts.addFlags(flags)
+	// Upload the downloaded PDFs to an S3-compatible object store
+	s3Bucket := flags.String("s3-bucket", "", "upload every downloaded PDF to this S3 bucket (default: no upload)")
+	s3Prefix := flags.String("s3-prefix", "", "key prefix of the uploaded PDFs, e.g. sds/")
+	s3Region := flags.String("s3-region", "", "region of the S3 bucket (default: from the AWS configuration)")
+	s3Endpoint := flags.String("s3-endpoint", "", "endpoint of an S3-compatible object store, e.g. http://localhost:9000 for MinIO")
+	// Skip the local copies when disk space is scarce
+	streamToS3 := flags.Bool("stream-to-s3", false, "stream the PDFs straight into the --s3-bucket without writing them to disk; the manifest records only the object keys")
+	// Expose Prometheus metrics and keep running after the pipeline finished
+	serve := flags.String("serve", "", "serve Prometheus metrics on this address (e.g. :9100) and keep running until interrupted")
+	// Liveness endpoint for container orchestrators
+	healthCheckURL := flags.String("health-check-url", "", "serve a liveness endpoint on this address and path, e.g. :9090/health (default: disabled)")
+	healthMaxErrorRate := flags.Float64("health-max-error-rate", 0.5, "share of failed page fetches and downloads (0 to 1) above which the liveness endpoint answers 503")
+	// Run the pipeline on a recurring cron schedule instead of once
+	schedule := flags.String("schedule", "", "run the scrape and download incrementally on this cron schedule (e.g. \"0 2 * * *\") until interrupted")
+	// Choose how much is logged
+	logLevel := flags.String("log-level", "info", "minimum level of the log entries: debug (including HTTP headers), info, warn (failures only) or error")
+	// Keep the log for retention, without filling the disk
+	logFile := flags.String("log-file", "", "also write the log to this file, rotated once it reaches --log-max-size-mb")
+	logMaxSizeMB := flags.Int("log-max-size-mb", 100, "rotate the --log-file once it reaches this many megabytes")
+	logMaxBackups := flags.Int("log-max-backups", 5, "keep this many rotated --log-file backups (0 = all)")
+	// Emit structured JSON log entries for downloads
+	logFormat := flags.String("log-format", "text", "log format of download entries: text (standard logger) or json (structured slog entries)")
+	// Scrape a private mirror of the SDS search instead of the public site
+	baseURL := flags.String("base-url", defaultBaseURL, "SDS search to scrape, e.g. an internal mirror; its site replaces https://www.ecolab.com in the PDF links")
+	// Remove tracking parameters from the extracted links
+	stripParams := flags.String("strip-params", strings.Join(defaultStripParams, ","), "comma-separated query parameters (path.Match patterns) removed from the extracted links")
+	// Look like current browsers to sites blocking unknown user agents
+	uaListURL := flags.String("ua-list-url", "", "request the search pages with user agents picked at random from the JSON array of strings at this URL (cached and updated with conditional requests)")
+	// Notify CI/CD pipelines at the end of each phase
+	webhookURL := flags.String("webhook-url", "", "POST a JSON summary {phase, status, counts, duration_ms, errors} to this URL at the end of each phase (default: no notification)")
+	webhookSecret := flags.String("webhook-secret", "", "sign the webhook body with HMAC-SHA256 using this secret, sent as "+webhookSignatureHeader+": sha256=<hex>")
+	// Tell the team on Slack how every run went
+	notifySlack := flags.String("notify-slack", "", "post a summary of every run to this Slack incoming webhook URL, and an alert when the scrape fails (default: no notification)")
+	// Choose how the extracted links are reported
+	outputFormat := flags.String("output-format", "text", "how to report the extracted links: text (links file only), ndjson (one JSON object per link on stdout), parquet or excel (manifest.parquet / manifest.xlsx in every country directory)")
+	// Record the links and their downloads for SQL queries
+	outputSQLite := flags.String("output-sqlite", "", "also record every extracted link, its metadata, file path and download status in this SQLite database (default: none)")
+	// Summarize the run for humans
+	report := flags.String("report", "", "write a report of every run: html (self-contained "+reportFileName+" in the current directory) (default: no report)")
+	// Read default flag values from a configuration file
+	configPath := flags.String("config", "", "YAML configuration file (default: ./"+configFileName+" or $XDG_CONFIG_HOME/ecolab-scraper/config.yaml)")
+	// List the environment variables after the flags in the usage
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s:\n", flags.Name())
+		flags.PrintDefaults()
+		printEnvironmentTable(flags)
+	}
+	// Parse the command line flags
+	if err := flags.Parse(args); err != nil {
+		return exitCode(flagsExitCode(err))
+	}
+	// Fill in the flags not given on the command line from the environment, then from the configuration file
+	if err := applyEnvironment(flags); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		*configPath = findConfigFile()
+	}
+	if *configPath != "" {
+		if err := applyConfigFile(flags, *configPath); err != nil {
+			return err
+		}
+	}
+	// Write the log to stderr and, for log retention, to a rotating file
+	logOutput := stderr
+	if *logFile != "" {
+		if err := validateLogRotation(*logMaxSizeMB, *logMaxBackups); err != nil {
+			return err
+		}
+		rotatingFile := newRotatingLogFile(*logFile, *logMaxSizeMB, *logMaxBackups)
+		defer rotatingFile.Close()
+		logOutput = io.MultiWriter(stderr, rotatingFile)
+		log.SetOutput(logOutput)    // The default slog handler writes through the standard logger as well
+		defer log.SetOutput(stderr) // Don't write to the closed file after the run
+	}
+	parsedBaseURL, err := parseBaseURL(*baseURL)
+	if err != nil {
+		return err
+	}
+	defer func(previousBaseURL string) { BaseURL = previousBaseURL }(BaseURL)
+	BaseURL = parsedBaseURL
+	// Reject unknown checksum algorithms before doing any work
+	if _, err := newChecksumHash(*checksumAlgo); err != nil {
+		return err
+	}
+	// Reject unknown output formats as well
+	if !slices.Contains([]string{"text", "ndjson", "parquet", "excel"}, *outputFormat) {
+		return fmt.Errorf("unknown output format %q (expected text, ndjson, parquet or excel)", *outputFormat)
+	}
+	// Reject unknown report formats as well
+	if *report != "" && *report != "html" {
+		return fmt.Errorf("unknown report format %q (expected html)", *report)
+	}
+	// Reject unknown log formats as well
+	if *logFormat != "text" && *logFormat != "json" {
+		return fmt.Errorf("unknown log format %q (expected text or json)", *logFormat)
+	}
+	// Look up chemical families instead of scraping
+	if *casLookup != "" {
+		return printCASLookup(stdout, *casLookup)
+	}
+	// Reject invalid product filters as well
+	productFilter, err := compileProductFilter(*filterProduct, *caseSensitive)
+	if err != nil {
+		return err
+	}
+	// Reject error rates that can never or always be exceeded
+	if *healthMaxErrorRate < 0 || *healthMaxErrorRate > 1 {
+		return fmt.Errorf("invalid --health-max-error-rate %g (expected 0 to 1)", *healthMaxErrorRate)
+	}
+	// Streaming needs a bucket to stream to
+	if *streamToS3 && *s3Bucket == "" {
+		return errors.New("--stream-to-s3 requires --s3-bucket")
+	}
+	// Reject chunk counts that make no sense as well
+	if *parallelChunks < 1 {
+		return fmt.Errorf("invalid --parallel-chunks %d (expected 1 or more)", *parallelChunks)
+	}
+	// Reject page sizes that make no sense as well
+	if *pageSize < 1 {
+		return fmt.Errorf("invalid --page-size %d (expected 1 or more)", *pageSize)
+	}
+	// Reject invalid page ranges as well
+	var startPage, endPage int
+	if *pages != "" {
+		var err error
+		if startPage, endPage, err = parsePageRange(*pages, *pageSize); err != nil {
+			return err
+		}
+	}
+	// Reject unknown log levels, then apply the level to every slog entry
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", *logLevel)
+	}
+	defer slog.SetLogLoggerLevel(slog.SetLogLoggerLevel(level)) // Restore the previous level after the run
+	// Install the trace exporter, falling back to the no-op tracer
+	shutdownTracing, err := setupTracing(context.Background(), *otelEndpoint)
+	if err != nil {
+		return err
+	}
+	// Flush the remaining spans before exiting
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Error shutting down tracing", "error", err)
+		}
+	}()
+	// Stop the run (or the schedule) cleanly on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Map each country to scrape onto the directory receiving its output
+	countryDirs := map[string]string{"United States": "."}
+	if countries := splitCommaList(*countriesFlag); len(countries) > 0 {
+		countryDirs = make(map[string]string)
+		for _, country := range countries {
+			countryDirs[country] = countryOutputDir(country)
+		}
+	}
+	// Counters of the runs, shared with the clients, the metrics and the health endpoint
+	stats := &Statistics{}
+	// Create the page client, keeping the session cookies, and the PDF client, with the TLS options
+	htmlClient, pdfClient, err := newScraperClients(tlsOpts, *timeoutPerPDF, stats, stderr)
+	if err != nil {
+		return err
+	}
+	// Authenticate the page and PDF requests to the --base-url host when credentials are given
+	if *user != "" {
+		authHost := siteHost(BaseURL)
+		htmlClient = withBasicAuth(htmlClient, authHost, *user, *password)
+		pdfClient = withBasicAuth(pdfClient, authHost, *user, *password)
+	}
+	// Log the headers of every request and response at debug level
+	if level <= slog.LevelDebug {
+		htmlClient = withHeaderLogging(htmlClient)
+		pdfClient = withHeaderLogging(pdfClient)
+	}
+	// Request the pages with current browser user agents when a list is given
+	var userAgents []string
+	if *uaListURL != "" {
+		agents, err := loadUserAgents(context.Background(), newHTTPClient(htmlRequestTimeout), *uaListURL, cacheFilePath("user-agents.json"))
+		if err != nil {
+			slog.Warn("Could not load the user agent list, using the default user agent", "url", *uaListURL, "error", err)
+		} else {
+			userAgents = agents
+			slog.Info("User agent list loaded", "user_agents", len(agents))
+		}
+	}
+	// Load the crawling rules of the site unless they are explicitly ignored
+	var robots *robotstxt.RobotsData
+	if !*ignoreRobots {
+		robots, err = fetchAndParseRobotsTxt(BaseURL)
+		if err != nil {
+			slog.Warn("Could not load robots.txt, pages will not be checked", "error", err)
 		}
 	}
+	// Assemble the pipeline from the flags
+	scraper := &Scraper{
+		CountryDirs:          countryDirs,
+		HTMLClient:           htmlClient,
+		UserAgents:           userAgents,
+		PDFClient:            pdfClient,
+		Robots:               robots,
+		Stats:                stats,
+		MaxConsecutiveErrors: *maxConsecutiveErrors,
+		Incremental:          *incremental,
+		RetryFailed:          *retryFailed,
+		StartPage:            startPage,
+		PageSize:             *pageSize,
+		PageDelay:            *pageDelay,
+		EndPage:              endPage,
+		Force:                *force,
+		Compress:             *compress,
+		Languages:            splitCommaList(*filterLanguage),
+		Include:              includePatterns,
+		Exclude:              excludePatterns,
+		StripParams:          splitCommaList(*stripParams),
+		ProductFilter:        productFilter,
+		CASPrefixes:          parseCASPrefixes(*filterCASPrefix),
+		MaxPDFs:              *maxPDFs,
+		MaxFileSize:          *maxFileSize,
+		MinFileSize:          *minFileSize,
+		ChecksumAlgo:         normalizeChecksumAlgo(*checksumAlgo),
+		ParallelChunks:       *parallelChunks,
+		SlowDownload:         *slowDownloadThreshold,
+		StreamToS3:           *streamToS3,
+		Report:               *report,
+		OutputFormat:         *outputFormat,
+		Output:               stdout,
+	}
+	// Upload the PDFs when a bucket is given
+	if *s3Bucket != "" {
+		if scraper.S3, err = newS3Uploader(ctx, *s3Bucket, *s3Prefix, *s3Region, *s3Endpoint); err != nil {
+			return err
+		}
+	}
+	// Record the links in a SQLite database when a path is given
+	if *outputSQLite != "" {
+		if scraper.SQLite, err = openSQLiteOutput(*outputSQLite); err != nil {
+			return err
+		}
+		defer scraper.SQLite.Close()
+	}
+	// Compare with an older manifest when one is given
+	if *sinceManifest != "" {
+		if scraper.Since, err = loadManifest(*sinceManifest); err != nil {
+			return err
+		}
+	}
+	// Notify the webhook at the end of each phase when a URL is given
+	if *webhookURL != "" {
+		scraper.Webhook = &webhookNotifier{URL: *webhookURL, Secret: *webhookSecret, Client: newHTTPClient(webhookTimeout)}
+	}
+	// Post to Slack when a webhook URL is given
+	if *notifySlack != "" {
+		scraper.Slack = &slackNotifier{URL: *notifySlack, Client: newHTTPClient(webhookTimeout)}
+	}
+	// Use a structured JSON logger when requested, the standard logger otherwise
+	if *logFormat == "json" {
+		scraper.Logger = slog.New(slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: level}))
+	}
+	// Start the metrics endpoint in server mode
+	if *serve != "" {
+		metricsServer := startMetricsServer(*serve, scraper.Stats)
+		defer metricsServer.Shutdown(context.Background())
+	}
+	// Start the liveness endpoint for long-running deployments
+	if *healthCheckURL != "" {
+		healthServer, err := startHealthServer(*healthCheckURL, scraper.Stats, *healthMaxErrorRate)
+		if err != nil {
+			return err
+		}
+		defer healthServer.Shutdown(context.Background())
+	}
+	// Run the pipeline on a schedule until interrupted
+	if *schedule != "" {
+		return runScheduled(ctx, scraper, *schedule)
+	}
+	// Run the pipeline once
+	if err := scraper.Run(ctx); err != nil {
+		return err
+	}
+	// In server mode keep the final metrics available until interrupted
+	if *serve != "" {
+		slog.Info("Run finished, still serving metrics. Press Ctrl+C to exit.", "addr", *serve)
+		<-ctx.Done()
+	}
+	return nil
 }
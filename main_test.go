@@ -0,0 +1,850 @@
+package main
+
+import (
+	"bytes"             // Captured output of run
+	"compress/gzip"     // Unpooled gzip writers
+	"context"           // Running the scrapes
+	"errors"            // Matching page errors
+	"fmt"               // Mock PDF links
+	"io"                // Mock server answers
+	"log"               // Checking the log output
+	"net/http"          // Mock search handler
+	"net/http/httptest" // Built-in mock server
+	"os"                // Output files
+	"path/filepath"     // Output paths
+	"slices"            // Comparing the failed pages
+	"strconv"           // Page offsets
+	"strings"           // Long file names
+	"sync/atomic"       // Counting the page requests
+	"testing"           // Test framework
+	"testing/iotest"    // Failing response bodies
+	"time"              // Modification time of the served PDFs
+
+	"github.com/temoto/robotstxt" // Disallowing the search pages
+)
+
+func TestStripTrackingParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawURL   string
+		patterns []string
+		want     string
+	}{
+		{"utm glob", "https://x.com/a.pdf?utm_source=news&id=1&utm_medium=email", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"utm glob ignores case", "https://x.com/a.pdf?UTM_Campaign=spring", defaultStripParams, "https://x.com/a.pdf"},
+		{"glob only matches the prefix", "https://x.com/a.pdf?xutm_source=1", defaultStripParams, "https://x.com/a.pdf?xutm_source=1"},
+		{"gclid", "https://x.com/a.pdf?gclid=abc123", defaultStripParams, "https://x.com/a.pdf"},
+		{"all tracking parameters", "https://x.com/a.pdf?fbclid=1&msclkid=2&_ga=3&mc_cid=4", defaultStripParams, "https://x.com/a.pdf"},
+		{"dclid", "https://x.com/a.pdf?dclid=abc&id=1", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"mc_eid", "https://x.com/a.pdf?id=1&mc_eid=7f3a", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"_gl", "https://x.com/a.pdf?_gl=1*abc*_ga*MTI3", defaultStripParams, "https://x.com/a.pdf"},
+		{"_hsenc", "https://x.com/a.pdf?_hsenc=p2ANqtz-abc&id=1", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"_hsmi", "https://x.com/a.pdf?_hsmi=12345", defaultStripParams, "https://x.com/a.pdf"},
+		{"escaped key", "https://x.com/a.pdf?utm%5Fsource=news&id=1", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"other parameters preserved", "https://x.com/a.pdf?version=2&lang=en", defaultStripParams, "https://x.com/a.pdf?version=2&lang=en"},
+		{"escaping preserved", "https://x.com/a.pdf?path=a%2fb&q=x+y&utm_source=news", defaultStripParams, "https://x.com/a.pdf?path=a%2fb&q=x+y"},
+		{"empty segments dropped", "https://x.com/a.pdf?utm_source=news&&id=1&", defaultStripParams, "https://x.com/a.pdf?id=1"},
+		{"fragment kept", "https://x.com/a.pdf?utm_source=news#page=2", defaultStripParams, "https://x.com/a.pdf#page=2"},
+		{"fragment without query", "https://x.com/a.pdf#page=2", defaultStripParams, "https://x.com/a.pdf#page=2"},
+		{"no query", "https://x.com/a.pdf", defaultStripParams, "https://x.com/a.pdf"},
+		{"empty patterns", "https://x.com/a.pdf?utm_source=news&gclid=abc", nil, "https://x.com/a.pdf?utm_source=news&gclid=abc"},
+		{"custom pattern", "https://x.com/a.pdf?session=1&id=2", []string{"session"}, "https://x.com/a.pdf?id=2"},
+		{"unparseable URL unchanged", "https://[::1/a.pdf?utm_source=x", defaultStripParams, "https://[::1/a.pdf?utm_source=x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := stripTrackingParams(test.rawURL, test.patterns); got != test.want {
+				t.Errorf("stripTrackingParams(%q) = %q, want %q", test.rawURL, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanExtractedLinksStripParams(t *testing.T) {
+	rawURL := "https://x.com/a.pdf?utm_source=news&gclid=abc"
+	tests := []struct {
+		name        string
+		stripParams []string
+		want        string
+	}{
+		{"defaults", defaultStripParams, "https://x.com/a.pdf"},
+		{"only gclid", []string{"gclid"}, "https://x.com/a.pdf?utm_source=news"},
+		{"empty --strip-params", splitCommaList(""), "https://x.com/a.pdf?utm_source=news&gclid=abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			links := cleanExtractedLinks([]SDSLink{{URL: rawURL}}, test.stripParams)
+			if links[0].URL != test.want {
+				t.Errorf("cleanExtractedLinks(%q) = %q, want %q", rawURL, links[0].URL, test.want)
+			}
+		})
+	}
+}
+
+// useBaseURL points the scraper at a mock search server for the duration of the test.
+func useBaseURL(t *testing.T, baseURL string) {
+	t.Helper()
+	previousBaseURL := BaseURL
+	BaseURL = baseURL
+	t.Cleanup(func() { BaseURL = previousBaseURL })
+}
+
+func TestScrapeContentAndSaveToFileForce(t *testing.T) {
+	server := newBenchmarkServer(0)
+	defer server.Close()
+	useBaseURL(t, server.URL+"/sds-search")
+	outputFile := filepath.Join(t.TempDir(), "ecolab-com.html")
+	// A single page holding all documents, so every scrape is a full scrape
+	opts := ScrapeOptions{Country: "United States", Client: server.Client(), PageSize: totalSDSDocuments, Stats: &Statistics{}}
+	scrape := func(opts ScrapeOptions) string {
+		t.Helper()
+		pageErrors, err := scrapeContentAndSaveToFile(context.Background(), outputFile, opts)
+		if err != nil || len(pageErrors) > 0 {
+			t.Fatalf("scrape failed: %v %v", err, pageErrors)
+		}
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+	first := scrape(opts)
+	if !fileExists(outputFile + doneFileSuffix) {
+		t.Fatal("complete scrape not marked as done")
+	}
+	opts.Force = true
+	if forced := scrape(opts); forced != first {
+		t.Errorf("forced scrape did not replace the output: %d bytes, want %d", len(forced), len(first))
+	}
+	if !fileExists(outputFile + doneFileSuffix) {
+		t.Error("forced scrape not marked as done")
+	}
+}
+
+func TestScrapeContentAndSaveToFileSkippedPage(t *testing.T) {
+	server := newBenchmarkServer(0)
+	defer server.Close()
+	useBaseURL(t, server.URL+"/sds-search")
+	outputFile := filepath.Join(t.TempDir(), "ecolab-com.html")
+	robots, err := robotstxt.FromString("User-agent: *\nDisallow: /sds-search\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageErrors, err := scrapeContentAndSaveToFile(context.Background(), outputFile, ScrapeOptions{
+		Country:  "United States",
+		PageSize: totalSDSDocuments,
+		Client:   server.Client(),
+		Robots:   robots,
+		Stats:    &Statistics{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pageErrors) != 1 || !errors.Is(&pageErrors[0], errRobotsDisallowed) {
+		t.Errorf("page errors = %v, want the page disallowed by robots.txt", pageErrors)
+	}
+	if fileExists(outputFile + doneFileSuffix) {
+		t.Error("scrape with a skipped page marked as done")
+	}
+}
+
+func TestScrapeContentAndSaveToFileKeepsOtherFailedPages(t *testing.T) {
+	server := newBenchmarkServer(0)
+	defer server.Close()
+	useBaseURL(t, server.URL+"/sds-search")
+	outputDir := t.TempDir()
+	// Four pages, of which the previous runs failed the first, the second and the last
+	pageSize := totalSDSDocuments / 4
+	failedPagesPath := filepath.Join(outputDir, failedPagesFileName)
+	if err := writeFailedPages(failedPagesPath, []int{0, pageSize, 3 * pageSize}); err != nil {
+		t.Fatal(err)
+	}
+	// Scrape the second and the third page only, like --pages 1:3
+	pageErrors, err := scrapeContentAndSaveToFile(context.Background(), filepath.Join(outputDir, "ecolab-com.html"), ScrapeOptions{
+		Country:   "United States",
+		PageSize:  pageSize,
+		StartPage: 1,
+		EndPage:   3,
+		Client:    server.Client(),
+		Stats:     &Statistics{},
+	})
+	if err != nil || len(pageErrors) > 0 {
+		t.Fatalf("scrape failed: %v %v", err, pageErrors)
+	}
+	offsets, err := readFailedPages(failedPagesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 3 * pageSize}; !slices.Equal(offsets, want) {
+		t.Errorf("failed pages after scraping 1:3 = %v, want %v", offsets, want)
+	}
+}
+
+func TestScrapeContentAndSaveToFileConsecutiveErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		failEvery int // Answer every failEvery-th page with 404 Not Found
+		wantAbort bool
+	}{
+		{"every page fails", 1, true},
+		{"successes in between", 2, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				offset, _ := strconv.Atoi(r.URL.Query().Get("first"))
+				if (offset/documentsPerPage)%test.failEvery == 0 {
+					http.NotFound(w, r) // Not retried, so every failure counts at once
+					return
+				}
+				io.WriteString(w, "<!DOCTYPE html><html><body>results</body></html>")
+			}))
+			defer server.Close()
+			useBaseURL(t, server.URL+"/sds-search")
+			pages := 20
+			_, err := scrapeContentAndSaveToFile(context.Background(), filepath.Join(t.TempDir(), "ecolab-com.html"), ScrapeOptions{
+				Country:              "United States",
+				TotalDocuments:       pages * documentsPerPage,
+				MaxConsecutiveErrors: 3,
+				Semaphore:            make(chan struct{}, 1), // One page at a time, so the failures are in a row
+				Client:               server.Client(),
+				Stats:                &Statistics{},
+			})
+			if !test.wantAbort {
+				if err != nil {
+					t.Fatalf("scrape with successes between the failures = %v, want no abort", err)
+				}
+				if got := requests.Load(); got != int32(pages) {
+					t.Errorf("server answered %d page requests, want all %d", got, pages)
+				}
+				return
+			}
+			var fetchErr *FetchError
+			if err == nil || !strings.Contains(err.Error(), "3 consecutive page fetches failed") ||
+				!errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound {
+				t.Fatalf("scrape of failing pages = %v, want an abort after 3 consecutive 404s", err)
+			}
+			if got := requests.Load(); got >= int32(pages) {
+				t.Errorf("server answered %d page requests, want the remaining pages cancelled", got)
+			}
+		})
+	}
+}
+
+// newSearchServer serves search result pages of cardsPerPage cards at /sds-search, linking
+// to the testPDF served for every path under /-/media/sds/.
+func newSearchServer(t *testing.T, cardsPerPage int) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sds-search", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		links := make([]SDSLink, cardsPerPage)
+		for index := range links {
+			links[index] = SDSLink{URL: fmt.Sprintf("http://%s/-/media/sds/sheet-%d.pdf", r.Host, offset+index), Language: "en"}
+		}
+		page, err := renderResultCards(links, "http://"+r.Host+r.URL.RequestURI())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/-/media/sds/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, testPDF)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunEndToEnd(t *testing.T) {
+	server := newSearchServer(t, 3)
+	t.Chdir(t.TempDir()) // The output of a single country goes into the current directory
+	previousLogOutput := log.Writer()
+	var stdout, stderr bytes.Buffer
+	err := run([]string{
+		"--base-url", server.URL + "/sds-search",
+		"--pages", "0:2",
+		"--ignore-robots",
+		"--min-file-size", "0",
+		"--config", os.DevNull,
+	}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stderr.String())
+	}
+	// Two pages of three cards each
+	files, err := filepath.Glob(filepath.Join("PDFs", "*.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("downloaded %d PDFs, want 6:\n%s", len(files), stderr.String())
+	}
+	links, err := os.ReadFile("ecolab-com-links.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := splitLines(string(links)); len(lines) != 6 {
+		t.Errorf("links file lists %d links, want 6", len(lines))
+	}
+	// The run leaves the process wide state as it found it
+	if log.Writer() != previousLogOutput {
+		t.Error("run did not restore the log output")
+	}
+	if BaseURL != defaultBaseURL {
+		t.Errorf("run left BaseURL at %q", BaseURL)
+	}
+}
+
+func TestRunSubcommandFlags(t *testing.T) {
+	subcommands := []string{"verify", "stats", "purge", "dedupe", "search", "validate-manifest", "mirror", "check-links", "diff", "benchmark"}
+	for _, subcommand := range subcommands {
+		t.Run(subcommand, func(t *testing.T) {
+			// Unknown flags are reported on stderr and exit with status 2, without exiting the process
+			var stdout, stderr bytes.Buffer
+			err := run([]string{subcommand, "--no-such-flag"}, &stdout, &stderr)
+			var exitErr exitCodeError
+			if !errors.As(err, &exitErr) || exitErr.code != 2 {
+				t.Errorf("run %s --no-such-flag = %v, want exit status 2", subcommand, err)
+			}
+			if !strings.Contains(stderr.String(), "flag provided but not defined") || stdout.Len() > 0 {
+				t.Errorf("run %s --no-such-flag printed stdout %q, stderr %q", subcommand, stdout.String(), stderr.String())
+			}
+			// The usage asked for is no failure
+			stdout.Reset()
+			stderr.Reset()
+			if err := run([]string{subcommand, "-h"}, &stdout, &stderr); err != nil {
+				t.Errorf("run %s -h = %v, want nil", subcommand, err)
+			}
+			if !strings.Contains(stderr.String(), "Usage of "+subcommand) {
+				t.Errorf("run %s -h printed no usage on stderr: %q", subcommand, stderr.String())
+			}
+		})
+	}
+}
+
+// searchResultsFixture is a canned search result page of the public site: ten result
+// cards and a PDF link in the footer.
+const searchResultsFixture = "testdata/search-results.html"
+
+func TestParsersExtractFixture(t *testing.T) {
+	fixture, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, parser := range []Parser{TokenizerParser{}, NodeTreeParser{}} {
+		t.Run(fmt.Sprintf("%T", parser), func(t *testing.T) {
+			links, err := parser.Parse(bytes.NewReader(fixture), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			links = cleanExtractedLinks(links, defaultStripParams)
+			if len(links) != 11 {
+				t.Fatalf("extracted %d links, want 11", len(links))
+			}
+			want := SDSLink{
+				URL:            "https://www.ecolab.com/-/media/sds/oasis-146-multi-quat-sanitizer-fr.pdf",
+				Language:       "fr",
+				Category:       "Sanitizers",
+				ProductName:    "Ecolab Oasis 146 Multi-Quat Sanitizer",
+				CASNumber:      "68424-85-1",
+				RevisionDate:   "03/14/2024",
+				LanguageSource: "card",
+				SourceURL:      "https://www.ecolab.com/sds-search?countryCode=United%20States&first=0",
+			}
+			if links[1] != want {
+				t.Errorf("second card = %+v, want %+v", links[1], want)
+			}
+			if footer := links[10]; footer.ProductName != "" || footer.Language != "en" || footer.LanguageSource != "page" {
+				t.Errorf("footer link = %+v, want no card metadata and the page language", footer)
+			}
+		})
+	}
+}
+
+// BenchmarkExtractDownloadLinks extracts the links of a large scrape output, the search
+// results fixture repeated 1000 times, like extractDownloadLinksFromFile does.
+func BenchmarkExtractDownloadLinks(b *testing.B) {
+	fixture, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dump := bytes.Repeat(fixture, 1000)
+	for _, parser := range []Parser{TokenizerParser{}, NodeTreeParser{}} {
+		b.Run(fmt.Sprintf("%T", parser), func(b *testing.B) {
+			b.SetBytes(int64(len(dump)))
+			b.ReportAllocs()
+			for b.Loop() {
+				links, err := parser.Parse(bytes.NewReader(dump), "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if links = cleanExtractedLinks(links, defaultStripParams); len(links) != 11000 {
+					b.Fatalf("extracted %d links, want 11000", len(links))
+				}
+			}
+		})
+	}
+}
+
+// FuzzExtractDownloadLinks feeds arbitrary bytes, e.g. truncated or mis-encoded scrape
+// output, to both parsers, which must neither panic nor lose the page URL. The seeds are
+// the fixture, result cards as served by the mirror and pages embedding their results as
+// JSON for client side rendering.
+//
+//	go test -fuzz=FuzzExtractDownloadLinks
+func FuzzExtractDownloadLinks(f *testing.F) {
+	fixture, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		f.Fatal(err)
+	}
+	cards, err := renderResultCards([]SDSLink{
+		{URL: "https://www.ecolab.com/-/media/sds/first.pdf", Language: "en", ProductName: "First & Co", CASNumber: "7173-51-5", RevisionDate: "01/02/2024"},
+		{URL: "https://www.ecolab.com/-/media/sds/second.pdf?utm_source=web", Language: "de", Category: "Sanitizers"},
+	}, "https://www.ecolab.com/sds-search?first=0")
+	if err != nil {
+		f.Fatal(err)
+	}
+	nextData := `<!DOCTYPE html><html lang="fr"><head><script id="__NEXT_DATA__" type="application/json">` +
+		`{"props":{"results":[{"pdf":"https://www.ecolab.com/-/media/sds/a.pdf","language":"German"},"https://www.ecolab.com/-/media/sds/b.PDF"]}}` +
+		`</script></head><body></body></html>`
+	f.Add(fixture)
+	f.Add(fixture[:len(fixture)/2])
+	f.Add([]byte(cards))
+	f.Add([]byte(cards + nextData)) // Two pages of the scrape output
+	f.Add([]byte(nextData))
+	f.Add([]byte(`<!DOCTYPE html><script type="application/ld+json">{"url": "https://x.com/a.pdf"`))
+	f.Add([]byte(""))
+	f.Add([]byte(`<a class="sds-download" href="`))
+	f.Add([]byte("<!DOCTYPE html><div class=\"result-card\"><a href=\"/x.pdf\xff\xfe\">"))
+	// Parse errors of single pages are logged
+	previousLogOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(previousLogOutput) })
+	const pageURL = "https://www.ecolab.com/sds-search?first=0"
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, parser := range []Parser{TokenizerParser{}, NodeTreeParser{}} {
+			links, err := parser.Parse(bytes.NewReader(data), pageURL)
+			if err != nil {
+				t.Fatalf("%T: Parse of an in-memory reader failed: %v", parser, err)
+			}
+			for _, link := range cleanExtractedLinks(links, defaultStripParams) {
+				if link.SourceURL == "" {
+					t.Errorf("%T: link %+v has no SourceURL", parser, link)
+				}
+			}
+		}
+	})
+}
+
+func TestGetFileNamesFromURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawURL  string
+		want    string
+		wantErr error // errInvalidPDFURL, or nil when want is expected
+	}{
+		// A query inside the path segment, as some CDNs send it
+		{"query string", "https://x.com/sds/sheet.pdf?download=true&token=abc123", "sheet.pdf", nil},
+		{"encoded query in the path segment", "https://x.com/sds/sheet.pdf%3Ftoken=abc", "sheet.pdf", nil},
+		{"encoded query and query string", "https://x.com/sds/Sheet.PDF%3Ftoken=abc?download=true", "sheet.pdf", nil},
+		// Links without a file to download
+		{"javascript link", "javascript:void(0)", "", errInvalidPDFURL},
+		{"empty link", "", "", errInvalidPDFURL},
+		{"other scheme", "ftp://x.com/sds/sheet.pdf", "", errInvalidPDFURL},
+		{"relative link", "/sds/sheet.pdf", "", errInvalidPDFURL},
+		{"no path", "https://x.com", "", errInvalidPDFURL},
+		{"root path", "https://x.com/", "", errInvalidPDFURL},
+		{"parent directory", "https://x.com/sds/..", "", errInvalidPDFURL},
+		{"invalid escape", "https://x.com/sds/%zz.pdf", "", errInvalidPDFURL},
+		{"raw null byte", "https://x.com/sds/a\x00b.pdf", "", errInvalidPDFURL},
+		// Names taken over as they are, lowercased
+		{"happy path", "https://www.ecolab.com/-/media/sds/Oasis-146-Multi-Quat.pdf", "oasis-146-multi-quat.pdf", nil},
+		{"http", "http://x.com/sds/sheet.pdf", "sheet.pdf", nil},
+		{"fragment", "https://x.com/sds/sheet.pdf#page=2", "sheet.pdf", nil},
+		{"non-ASCII", "https://x.com/sds/Größe-Überblick.pdf", "größe-überblick.pdf", nil},
+		{"non-latin", "https://x.com/sds/安全データシート.pdf", "安全データシート.pdf", nil},
+		// Percent-encoding is decoded before the name is sanitized
+		{"encoded space", "https://x.com/sds/safety%20sheet.pdf", "safety_sheet.pdf", nil},
+		{"encoded non-ASCII", "https://x.com/sds/fa%C3%A7ade.pdf", "façade.pdf", nil},
+		{"encoded slash", "https://x.com/sds%2Fsheet.pdf", "sheet.pdf", nil},
+		{"encoded Windows-illegal characters", "https://x.com/a%3Cb%3Ec%3Ad%22e%7Cf%2Ag.pdf", "abcdefg.pdf", nil},
+		{"encoded backslash", "https://x.com/sds/a%5Cb.pdf", "ab.pdf", nil},
+		{"encoded null byte", "https://x.com/sds/a%00b.pdf", "ab.pdf", nil},
+		{"encoded control character", "https://x.com/sds/a%1Fb.pdf", "ab.pdf", nil},
+		// Names the file system would reject are shortened to 255 bytes
+		{"long name", "https://x.com/sds/" + strings.Repeat("a", 300) + ".pdf", strings.Repeat("a", 251) + ".pdf", nil},
+		{"long multibyte name", "https://x.com/sds/" + strings.Repeat("ü", 200) + ".pdf", strings.Repeat("ü", 125) + ".pdf", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := getFileNamesFromURLs(test.rawURL)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("getFileNamesFromURLs(%q) = %q, %v, want %v", test.rawURL, got, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("getFileNamesFromURLs(%q) = %q, %v, want %q", test.rawURL, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestStatPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sheet.pdf")
+	if err := os.WriteFile(file, []byte(testPDF), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	locked := filepath.Join(dir, "locked")
+	if err := os.Mkdir(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) }) // Let t.TempDir remove it
+	tests := []struct {
+		name       string
+		path       string
+		wantExists bool
+		wantIsDir  bool
+		wantErr    bool
+	}{
+		{"missing path", filepath.Join(dir, "missing"), false, false, false},
+		{"missing parent", filepath.Join(dir, "missing", "sheet.pdf"), false, false, false},
+		{"file", file, true, false, false},
+		{"directory", dir, true, true, false},
+		{"symlink to a directory", filepath.Join(dir, "link"), true, true, false},
+		{"dangling symlink", filepath.Join(dir, "dangling"), false, false, false},
+		{"below a file", filepath.Join(file, "child"), false, false, true},
+		{"permission denied parent", filepath.Join(locked, "sheet.pdf"), false, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "permission denied parent" && os.Geteuid() == 0 {
+				t.Skip("root is never denied permission")
+			}
+			exists, isDir, err := statPath(test.path)
+			if exists != test.wantExists || isDir != test.wantIsDir || (err != nil) != test.wantErr {
+				t.Errorf("statPath(%q) = %t, %t, %v, want %t, %t, error %t",
+					test.path, exists, isDir, err, test.wantExists, test.wantIsDir, test.wantErr)
+			}
+		})
+	}
+}
+
+// shortWriter accepts at most limit bytes per write without reporting an error, like a
+// broken io.Writer.
+type shortWriter struct {
+	limit int
+}
+
+func (w shortWriter) Write(data []byte) (int, error) {
+	return min(len(data), w.limit), nil
+}
+
+// failingWriter fails every write with err.
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(data []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestWriteBytes(t *testing.T) {
+	data := []byte("<!DOCTYPE html><html></html>")
+	var buffer bytes.Buffer
+	if err := writeBytes(&buffer, data); err != nil {
+		t.Fatalf("writeBytes to a buffer: %v", err)
+	}
+	if buffer.String() != string(data) {
+		t.Errorf("buffer holds %q, want %q", buffer.String(), data)
+	}
+	if err := writeBytes(shortWriter{limit: 4}, data); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("writeBytes to a short writer = %v, want io.ErrShortWrite", err)
+	}
+	diskFull := errors.New("no space left on device")
+	if err := writeBytes(failingWriter{err: diskFull}, data); !errors.Is(err, diskFull) {
+		t.Errorf("writeBytes to a failing writer = %v, want %v", err, diskFull)
+	}
+	// The gzip member is only written once complete, so the failure is the writer's as well
+	if err := writePage(failingWriter{err: diskFull}, data, true); !errors.Is(err, diskFull) {
+		t.Errorf("writePage with compress to a failing writer = %v, want %v", err, diskFull)
+	}
+}
+
+// BenchmarkAppendByteToFile appends the search results fixture to a file, as the scrape
+// did for every page, with and without --compress.
+func BenchmarkAppendByteToFile(b *testing.B) {
+	page, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, compress := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compress=%t", compress), func(b *testing.B) {
+			filename := filepath.Join(b.TempDir(), "ecolab-com.html")
+			b.SetBytes(int64(len(page)))
+			b.ReportAllocs()
+			appended := 0
+			for b.Loop() {
+				// Start over now and then, so the file doesn't fill the disk
+				if appended++; appended%10000 == 0 {
+					b.StopTimer()
+					os.Remove(filename)
+					b.StartTimer()
+				}
+				if err := appendByteToFile(filename, page, compress); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWritePage writes the search results fixture as scrapeContent does for every
+// page, without and with --compress, and compressed without the pools, allocating a
+// gzip writer and a buffer per page.
+func BenchmarkWritePage(b *testing.B) {
+	page, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+	writers := []struct {
+		name  string
+		write func(data []byte) error
+	}{
+		{"compress=false", func(data []byte) error { return writePage(io.Discard, data, false) }},
+		{"compress=true", func(data []byte) error { return writePage(io.Discard, data, true) }},
+		{"compress=true/unpooled", func(data []byte) error {
+			var buffer bytes.Buffer
+			gzipWriter := gzip.NewWriter(&buffer)
+			if err := writeBytes(gzipWriter, data); err != nil {
+				return err
+			}
+			if err := gzipWriter.Close(); err != nil {
+				return err
+			}
+			return writeBytes(io.Discard, buffer.Bytes())
+		}},
+	}
+	for _, writer := range writers {
+		b.Run(writer.name, func(b *testing.B) {
+			b.SetBytes(int64(len(page)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := writer.write(page); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newRefererServer serves body as a PDF, with HEAD and Range support, but only to
+// requests sent with the Referer wantReferer; all others get 403 Forbidden, like the
+// hotlink protection of some CDNs.
+func newRefererServer(t *testing.T, wantReferer string, body []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != wantReferer {
+			http.Error(w, "hotlinking not allowed", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "sheet.pdf", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPDFRequestsReferer(t *testing.T) {
+	useBaseURL(t, "https://sds.example.com/sds-search")
+	sourceURL := "https://www.ecolab.com/sds-search?countryCode=United+States&first=10"
+	// Large enough to be downloaded in parallel chunks
+	largePDF := append([]byte("%PDF-1.4\n"), make([]byte, parallelChunkThreshold)...)
+	tests := []struct {
+		name           string
+		sourceURL      string // SourceURL of the link
+		serverReferer  string // Referer the server requires
+		parallelChunks int
+		wantErr        bool
+	}{
+		{"source URL", sourceURL, sourceURL, 1, false},
+		{"source URL in chunks", sourceURL, sourceURL, 4, false},
+		{"base URL fallback", "", "https://sds.example.com/sds-search", 1, false},
+		{"base URL fallback in chunks", "", "https://sds.example.com/sds-search", 4, false},
+		{"source URL required", "", sourceURL, 1, true},
+		{"other page", "https://www.ecolab.com/sds-search?first=20", sourceURL, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := []byte(testPDF)
+			if test.parallelChunks > 1 {
+				body = largePDF
+			}
+			server := newRefererServer(t, test.serverReferer, body)
+			link := SDSLink{URL: server.URL + "/-/media/sds/sheet.pdf", SourceURL: test.sourceURL}
+			folder := t.TempDir()
+			opts := DownloadOptions{Client: server.Client(), ParallelChunks: test.parallelChunks, Stats: &Statistics{}}
+			_, err := downloadPDF(context.Background(), opts, link, folder, nil)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "403") {
+					t.Errorf("downloadPDF with the wrong Referer = %v, want 403 Forbidden", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadPDF: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(folder, "sheet.pdf"))
+			if err != nil || !bytes.Equal(content, body) {
+				t.Errorf("downloaded %d bytes (%v), want %d", len(content), err, len(body))
+			}
+			// The pre-flight and single chunks send the Referer as well
+			if _, _, err := headPDF(context.Background(), server.Client(), link.URL, link.referer()); err != nil {
+				t.Errorf("headPDF: %v", err)
+			}
+			if err := downloadChunk(context.Background(), server.Client(), link.URL, link.referer(), nil, io.Discard, 0, 3); err != nil {
+				t.Errorf("downloadChunk: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadPDFResume(t *testing.T) {
+	body := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("sheet "), 1000)...)
+	partial := len(body) / 3 // Bytes saved by the interrupted download
+	tests := []struct {
+		name         string
+		ignoreRanges bool // Answer every GET with the whole PDF and 200 OK
+	}{
+		{"range honoured", false},
+		// The partial file must be replaced, not appended to
+		{"range ignored", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotRange string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					gotRange = r.Header.Get("Range")
+				}
+				if test.ignoreRanges {
+					w.Header().Set("Content-Type", "application/pdf")
+					w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+					w.Write(body)
+					return
+				}
+				http.ServeContent(w, r, "sheet.pdf", time.Time{}, bytes.NewReader(body))
+			}))
+			defer server.Close()
+			folder := t.TempDir()
+			fullPath := filepath.Join(folder, "sheet.pdf")
+			if err := os.WriteFile(fullPath, body[:partial], 0644); err != nil {
+				t.Fatal(err)
+			}
+			opts := DownloadOptions{Client: server.Client(), Stats: &Statistics{}}
+			link := SDSLink{URL: server.URL + "/-/media/sds/sheet.pdf"}
+			if _, err := downloadPDF(context.Background(), opts, link, folder, nil); err != nil {
+				t.Fatalf("downloadPDF: %v", err)
+			}
+			if wantRange := fmt.Sprintf("bytes=%d-", partial); gotRange != wantRange {
+				t.Errorf("Range = %q, want only the missing tail %q", gotRange, wantRange)
+			}
+			content, err := os.ReadFile(fullPath)
+			if err != nil || !bytes.Equal(content, body) {
+				t.Errorf("resumed file has %d bytes (%v), want the %d bytes of the PDF", len(content), err, len(body))
+			}
+		})
+	}
+}
+
+// newCookieServer answers search pages with 403 Forbidden until the request carries the
+// session cookie, which the forbidden answer sets, like an anti-bot challenge.
+func newCookieServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "challenge-passed" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "challenge-passed", Path: "/"})
+			http.Error(w, "challenge", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "<!DOCTYPE html><html><body>results</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithCookieJar(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     func(*httptest.Server) *http.Client
+		wantSecond bool // Whether the request after the challenge succeeds
+	}{
+		{"without jar", func(server *httptest.Server) *http.Client { return server.Client() }, false},
+		{"with jar", func(server *httptest.Server) *http.Client { return withCookieJar(server.Client()) }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newCookieServer(t)
+			client := test.client(server)
+			pageURL := server.URL + "/sds-search?first=0"
+			// The first request has no cookie yet
+			_, err := fetchPageHTML(context.Background(), client, pageURL, nil, nil)
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusForbidden {
+				t.Fatalf("first request = %v, want 403 Forbidden", err)
+			}
+			_, err = fetchPageHTML(context.Background(), client, server.URL+"/sds-search?first=10", nil, nil)
+			if test.wantSecond && err != nil {
+				t.Errorf("request with the cookie of the jar = %v, want 200 OK", err)
+			}
+			if !test.wantSecond && (!errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusForbidden) {
+				t.Errorf("request without the cookie = %v, want 403 Forbidden", err)
+			}
+		})
+	}
+}
+
+func TestReadHTMLTokens(t *testing.T) {
+	fixture, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The page is kept byte for byte, broken or not
+	pages := map[string]string{
+		"fixture":              string(fixture),
+		"empty":                "",
+		"text":                 "a<b & c",
+		"truncated tag":        `<div class="result-card"><a href="/x.pdf`,
+		"unterminated script":  "<script>if (a<b) x</scr",
+		"unterminated comment": "<!-- results",
+		"invalid UTF-8":        "<p>\xff\xfe caf\xe9</p>",
+	}
+	for name, page := range pages {
+		t.Run(name, func(t *testing.T) {
+			got, err := readHTMLTokens(strings.NewReader(page), int64(len(page)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != page {
+				t.Errorf("readHTMLTokens = %q, want %q", got, page)
+			}
+		})
+	}
+	t.Run("read error", func(t *testing.T) {
+		errReset := errors.New("connection reset")
+		if _, err := readHTMLTokens(io.MultiReader(strings.NewReader("<p>"), iotest.ErrReader(errReset)), -1); !errors.Is(err, errReset) {
+			t.Errorf("readHTMLTokens of a failing body = %v, want %v", err, errReset)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json" // JSON encoding of the manifest
+	"errors"        // Error inspection
+	"fmt"           // Formatting for error messages
+	"io"            // Streaming file contents into the hash
+	"io/fs"         // Filesystem error values
+	"os"            // File operations
+	"slices"        // Entry removal
+)
+
+// ManifestEntry records one downloaded SDS PDF together with the metadata of its link.
+type ManifestEntry struct {
+	SDSLink               // Metadata of the link the PDF was downloaded from
+	FilePath     string   `json:"file_path,omitempty"` // Local path of the downloaded PDF (empty when streamed to S3)
+	Checksum     Checksum `json:"checksum"`            // Checksum of the file contents, see --checksum-algo
+	LegacySHA256 string   `json:"sha256,omitempty"`    // SHA-256 of manifests written before Checksum, moved into it by loadManifest
+	Size         int64    `json:"size"`                // File size in bytes
+	S3Key        string   `json:"s3_key,omitempty"`    // Object key of the uploaded copy, if uploaded to S3
+	pdfMetadata           // What the server reported about the PDF, for the next run
+}
+
+// pdfMetadata is what the server last reported about a PDF, cached in the manifest. The
+// download durations of many runs show CDN degradation trends.
+type pdfMetadata struct {
+	pageValidators            // ETag / Last-Modified, for conditional requests
+	ContentType        string `json:"content_type,omitempty"`         // Content-Type of the HEAD pre-flight or the download
+	ContentLength      int64  `json:"content_length,omitempty"`       // Size announced by the server
+	DownloadDurationMS int64  `json:"download_duration_ms,omitempty"` // Time from sending the download request to closing the body
+}
+
+// Manifest lists every PDF downloaded into an output directory.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// loadManifest reads the manifest at path. A missing file yields an empty manifest. The
+// SHA-256 of entries written before the checksum object is moved into their Checksum.
+func loadManifest(path string) (*Manifest, error) {
+	manifest := &Manifest{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil // No download has been recorded yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", path, err)
+	}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("error decoding manifest %s: %w", path, err)
+	}
+	for index := range manifest.Entries {
+		entry := &manifest.Entries[index]
+		if entry.Checksum.Hash == "" && entry.LegacySHA256 != "" {
+			entry.Checksum = Checksum{Algo: "sha256", Hash: entry.LegacySHA256}
+		}
+		entry.LegacySHA256 = ""
+	}
+	return manifest, nil
+}
+
+// save writes the manifest to path, replacing the previous version atomically.
+func (manifest *Manifest) save(path string) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	// Write to a temporary file first so a crash never leaves a truncated manifest
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing manifest %s: %w", temporaryPath, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf("error replacing manifest %s: %w", path, err)
+	}
+	return nil
+}
+
+// upsert adds the entry, replacing any existing entry with the same URL.
+func (manifest *Manifest) upsert(entry ManifestEntry) {
+	for index := range manifest.Entries {
+		if manifest.Entries[index].URL == entry.URL {
+			manifest.Entries[index] = entry
+			return
+		}
+	}
+	manifest.Entries = append(manifest.Entries, entry)
+}
+
+// remove deletes the entry recorded for url, if any.
+func (manifest *Manifest) remove(url string) {
+	manifest.Entries = slices.DeleteFunc(manifest.Entries, func(entry ManifestEntry) bool { return entry.URL == url })
+}
+
+// find returns the entry recorded for url, or nil when the URL is not in the manifest.
+func (manifest *Manifest) find(url string) *ManifestEntry {
+	for index := range manifest.Entries {
+		if manifest.Entries[index].URL == url {
+			return &manifest.Entries[index]
+		}
+	}
+	return nil
+}
+
+// hashFile returns the checksum computed with algo ("" = defaultChecksumAlgo) and the
+// size of the file at path.
+func hashFile(path string, algo string) (Checksum, int64, error) {
+	hasher, err := newChecksumHash(algo)
+	if err != nil {
+		return Checksum{}, 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return Checksum{}, 0, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return Checksum{}, 0, fmt.Errorf("error hashing %s: %w", path, err)
+	}
+	return checksumOf(algo, hasher), size, nil
+}
+
+// newManifestEntry hashes the downloaded file at filePath with algo ("" = defaultChecksumAlgo)
+// and describes it as a manifest entry.
+func newManifestEntry(link SDSLink, filePath string, algo string) (ManifestEntry, error) {
+	checksum, size, err := hashFile(filePath, algo)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{SDSLink: link, FilePath: filePath, Checksum: checksum, Size: size}, nil
+}
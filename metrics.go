@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"   // Error inspection
+	"log/slog" // Logging server errors
+	"net/http" // Metrics HTTP server
+	"time"     // Durations
+
+	"github.com/prometheus/client_golang/prometheus"          // Metric descriptions and registry
+	"github.com/prometheus/client_golang/prometheus/promhttp" // Prometheus text format handler
+)
+
+// statisticsCollector exposes the run Statistics as Prometheus metrics.
+type statisticsCollector struct {
+	stats               *Statistics
+	pdfsTotal           *prometheus.Desc
+	pdfsDownloaded      *prometheus.Desc
+	downloadErrors      *prometheus.Desc
+	lastScrapeTimestamp *prometheus.Desc
+	scrapeDuration      *prometheus.Desc
+}
+
+// newStatisticsCollector creates a collector reading the counters of stats on every scrape.
+func newStatisticsCollector(stats *Statistics) *statisticsCollector {
+	return &statisticsCollector{
+		stats:               stats,
+		pdfsTotal:           prometheus.NewDesc("ecolab_pdfs_total", "Number of PDF links selected for download.", nil, nil),
+		pdfsDownloaded:      prometheus.NewDesc("ecolab_pdfs_downloaded", "Number of PDFs written to disk.", nil, nil),
+		downloadErrors:      prometheus.NewDesc("ecolab_download_errors_total", "Number of failed PDF downloads.", nil, nil),
+		lastScrapeTimestamp: prometheus.NewDesc("ecolab_last_scrape_timestamp", "Unix time at which the last scrape phase finished.", nil, nil),
+		scrapeDuration:      prometheus.NewDesc("ecolab_scrape_duration_seconds", "Duration of the last scrape phase in seconds.", nil, nil),
+	}
+}
+
+// Describe sends the descriptions of all metrics of the collector.
+func (collector *statisticsCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- collector.pdfsTotal
+	descriptions <- collector.pdfsDownloaded
+	descriptions <- collector.downloadErrors
+	descriptions <- collector.lastScrapeTimestamp
+	descriptions <- collector.scrapeDuration
+}
+
+// Collect sends the current value of every metric.
+func (collector *statisticsCollector) Collect(metrics chan<- prometheus.Metric) {
+	stats := collector.stats
+	metrics <- prometheus.MustNewConstMetric(collector.pdfsTotal, prometheus.GaugeValue, float64(stats.PDFsTotal.Load()))
+	metrics <- prometheus.MustNewConstMetric(collector.pdfsDownloaded, prometheus.GaugeValue, float64(stats.PDFsDownloaded.Load()))
+	metrics <- prometheus.MustNewConstMetric(collector.downloadErrors, prometheus.CounterValue, float64(stats.DownloadErrors.Load()))
+	metrics <- prometheus.MustNewConstMetric(collector.lastScrapeTimestamp, prometheus.GaugeValue, float64(stats.LastScrapeUnix.Load()))
+	metrics <- prometheus.MustNewConstMetric(collector.scrapeDuration, prometheus.GaugeValue, time.Duration(stats.ScrapeDuration.Load()).Seconds())
+}
+
+// startMetricsServer serves the statistics in Prometheus text format on addr/metrics
+// in the background and returns the server so it can be shut down.
+func startMetricsServer(addr string, stats *Statistics) *http.Server {
+	// Use a dedicated registry so only the scraper metrics are exposed
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newStatisticsCollector(stats))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error serving metrics", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", addr+"/metrics")
+	return server
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"       // Cancellation of the run
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the summary
+	"io"            // Log output
+	"log"           // Log output of the rotating file
+	"log/slog"      // Logging errors
+	"net/http"      // Clients of the sync
+	"os"            // Interrupt signal
+	"os/signal"     // Interrupt handling
+	"path/filepath" // Path manipulation
+	"strings"       // Logging the diff line by line
+	"syscall"       // Termination signal
+	"time"          // Watch interval
+
+	"github.com/temoto/robotstxt" // Checking the page of the SDS count
+)
+
+// mirrorOptions are the settings of one mirror sync.
+type mirrorOptions struct {
+	OutputDir    string       // Directory kept in sync with the site
+	Country      string       // Country whose SDS sheets are mirrored
+	Languages    []string     // Only download SDS sheets in these ISO 639-1 languages (empty = all)
+	IgnoreRobots bool         // Fetch the pages without checking robots.txt
+	HTMLClient   *http.Client // Client fetching the search pages, see newScraperClients
+	PDFClient    *http.Client // Client downloading the PDFs
+	Stats        *Statistics  // Counters of the clients and the runs
+	Output       io.Writer    // Destination of the report of what changed
+}
+
+// runMirror implements the "mirror" subcommand: it brings a local directory in line with
+// the live site, like rsync for SDS sheets. The current SDS count is fetched first and the
+// copies of the pages past the last one are dropped. The search pages that changed are scraped
+// again (pages answering 304 keep their copy in pages/), new and updated PDFs are
+// downloaded, PDFs no longer listed are moved to PDFs/.trash and the manifest is updated.
+// It prints what changed and returns the process exit code. With --watch the mirror is
+// synced again after every interval until interrupted, see watchMirror.
+func runMirror(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	outputDir := flags.String("dir", ".", "directory kept in sync with the site")
+	country := flags.String("country", "United States", "country whose SDS sheets are mirrored")
+	filterLanguage := flags.String("filter-language", "", "only download SDS sheets in these comma-separated ISO 639-1 languages (e.g. en,fr)")
+	ignoreRobots := flags.Bool("ignore-robots", false, "do not check robots.txt before fetching pages (only with explicit permission from the site owner)")
+	watch := flags.Duration("watch", 0, "sync the mirror again this long after every sync until interrupted, logging what changed (0 = sync once)")
+	logFile := flags.String("log-file", "", "also write the log to this file, rotated once it reaches --log-max-size-mb")
+	logMaxSizeMB := flags.Int("log-max-size-mb", 100, "rotate the --log-file once it reaches this many megabytes")
+	logMaxBackups := flags.Int("log-max-backups", 5, "keep this many rotated --log-file backups (0 = all)")
+	// Connect like the scraper, with the same TLS options
+	var tlsOpts tlsOptions
+	tlsOpts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+	if *watch < 0 {
+		slog.Error("mirror: invalid --watch (expected a positive interval)", "watch", *watch)
+		return 2
+	}
+	// Write the log to stderr and, for long running watches, to a rotating file
+	if *logFile != "" {
+		if err := validateLogRotation(*logMaxSizeMB, *logMaxBackups); err != nil {
+			slog.Error("mirror: invalid log rotation", "error", err)
+			return 2
+		}
+		rotatingFile := newRotatingLogFile(*logFile, *logMaxSizeMB, *logMaxBackups)
+		defer rotatingFile.Close()
+		previousOutput := log.Writer()
+		log.SetOutput(io.MultiWriter(previousOutput, rotatingFile))
+		defer log.SetOutput(previousOutput) // Don't write to the closed file afterwards
+	}
+	stats := &Statistics{}
+	htmlClient, pdfClient, err := newScraperClients(tlsOpts, pdfRequestTimeout, stats, stderr)
+	if err != nil {
+		slog.Error("mirror: invalid TLS options", "error", err)
+		return 2
+	}
+	opts := mirrorOptions{
+		OutputDir:    *outputDir,
+		Country:      *country,
+		Languages:    splitCommaList(*filterLanguage),
+		IgnoreRobots: *ignoreRobots,
+		HTMLClient:   htmlClient,
+		PDFClient:    pdfClient,
+		Stats:        stats,
+		Output:       stdout,
+	}
+	if *watch > 0 {
+		return watchMirror(opts, *watch)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return syncMirror(ctx, opts)
+}
+
+// watchMirror syncs the mirror, waits for interval and repeats until interrupted. After
+// every sync the manifest is compared with the one before it and the changes are logged.
+// The first Ctrl+C or SIGTERM lets the current sync complete and then exits cleanly; a
+// second one terminates the process right away.
+func watchMirror(opts mirrorOptions, interval time.Duration) int {
+	watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Restore the default signal handling, so a second signal is not swallowed
+	context.AfterFunc(watchCtx, func() {
+		slog.Info("Stopping the watch after the current sync, interrupt again to abort it")
+		stop()
+	})
+	manifestPath := filepath.Join(opts.OutputDir, "manifest.json")
+	for cycle := 1; ; cycle++ {
+		previousManifest, err := loadManifest(manifestPath)
+		if err != nil {
+			slog.Error("Error loading manifest", "path", manifestPath, "error", err)
+			return 1
+		}
+		startTime := time.Now()
+		// The sync is not cancelled by the signal, it always runs to completion
+		if code := syncMirror(context.Background(), opts); code != 0 {
+			slog.Warn("Watch sync failed, trying again at the next sync", "sync", cycle, "exit_code", code)
+		}
+		currentManifest, err := loadManifest(manifestPath)
+		if err != nil {
+			slog.Error("Error loading manifest", "path", manifestPath, "error", err)
+			return 1
+		}
+		// Log the changes of this sync with the diff subcommand's report
+		slog.Info("Watch sync finished", "sync", cycle, "duration", time.Since(startTime).Round(time.Second))
+		var report strings.Builder
+		printManifestDiff(&report, diffManifests(previousManifest, currentManifest))
+		for _, line := range splitLines(report.String()) {
+			slog.Info("Change since the previous sync", "sync", cycle, "change", line)
+		}
+		if watchCtx.Err() != nil {
+			slog.Info("Watch stopped")
+			return 0
+		}
+		slog.Info("Next sync scheduled", "at", time.Now().Add(interval).Format(time.DateTime))
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-watchCtx.Done():
+			timer.Stop()
+			slog.Info("Watch stopped")
+			return 0
+		}
+	}
+}
+
+// syncMirror brings the mirror in opts.OutputDir in line with the site once, prints what
+// changed to opts.Output and returns the process exit code.
+func syncMirror(ctx context.Context, opts mirrorOptions) int {
+	stdout := opts.Output
+	// Remember the state of the mirror before syncing
+	manifestPath := filepath.Join(opts.OutputDir, "manifest.json")
+	oldManifest, err := loadManifest(manifestPath)
+	if err != nil {
+		slog.Error("Error loading manifest", "path", manifestPath, "error", err)
+		return 1
+	}
+	// Scrape the changed pages and download the new and updated PDFs
+	scraper := &Scraper{
+		CountryDirs:          map[string]string{opts.Country: opts.OutputDir},
+		HTMLClient:           opts.HTMLClient,
+		PDFClient:            opts.PDFClient,
+		Stats:                opts.Stats,
+		MaxConsecutiveErrors: 10,
+		Incremental:          true,
+		Snapshot:             true,
+		Languages:            opts.Languages,
+		StripParams:          defaultStripParams,
+		OutputFormat:         "text",
+	}
+	if !opts.IgnoreRobots {
+		if scraper.Robots, err = fetchAndParseRobotsTxt(BaseURL); err != nil {
+			slog.Warn("Could not load robots.txt, pages will not be checked", "error", err)
+		}
+	}
+	if err := ensureDir(0755, opts.OutputDir); err != nil {
+		slog.Error("Error creating mirror directory", "dir", opts.OutputDir, "error", err)
+		return 1
+	}
+	// Fetch the current SDS count first, so every page is scraped and the copies of the
+	// pages past the last one no longer list their documents
+	if total, err := fetchSDSCount(ctx, scraper.HTMLClient, scraper.Robots, opts.Country); err != nil {
+		slog.Warn("Could not fetch the SDS count, scraping the default number of pages", "total", totalSDSDocuments, "error", err)
+	} else {
+		scraper.TotalDocuments = total
+		pruned, err := prunePageSnapshot(filepath.Join(opts.OutputDir, "pages"), total)
+		if err != nil {
+			slog.Error("Error pruning page copies", "error", err)
+			return 1
+		}
+		slog.Info("SDS count fetched", "total", total, "pruned_pages", pruned)
+	}
+	runErr := scraper.Run(ctx)
+	if ctx.Err() != nil {
+		slog.Warn("Mirror interrupted, nothing purged")
+		return 1
+	}
+	if runErr != nil {
+		slog.Error("Error syncing mirror, nothing purged", "error", runErr)
+		return 1
+	}
+
+	// Every link still listed on the site; a partly read list would purge too much
+	links, err := extractDownloadLinksFromFile(filepath.Join(opts.OutputDir, "ecolab-com.html"), nil, defaultStripParams)
+	if err != nil {
+		slog.Error("Error extracting download links, nothing purged", "error", err)
+		return 1
+	}
+	listed := make(map[string]bool)
+	for _, link := range links {
+		listed[link.URL] = true
+	}
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		slog.Error("Error loading manifest", "path", manifestPath, "error", err)
+		return 1
+	}
+	// Purge the PDFs that disappeared from the site, unless the site listed nothing at all
+	var removed []ManifestEntry
+	if len(listed) == 0 {
+		slog.Warn("No links found on the site, nothing purged")
+	} else {
+		for _, entry := range manifest.Entries {
+			if !listed[entry.URL] {
+				removed = append(removed, entry)
+			}
+		}
+	}
+	failed := 0
+	for _, entry := range removed {
+		if fileExists(entry.FilePath) {
+			if _, err := moveToTrash(entry.FilePath); err != nil {
+				slog.Error("Error purging file", "path", entry.FilePath, "error", err)
+				failed++
+				continue
+			}
+		}
+		manifest.remove(entry.URL)
+		fmt.Fprintf(stdout, "-  %s\n", entry.URL)
+	}
+	if err := manifest.save(manifestPath); err != nil {
+		slog.Error("Error saving manifest", "path", manifestPath, "error", err)
+		return 1
+	}
+
+	// Compare the manifest with the one before the sync
+	added, updated, unchanged := 0, 0, 0
+	for _, entry := range manifest.Entries {
+		previous := oldManifest.find(entry.URL)
+		switch {
+		case previous == nil:
+			fmt.Fprintf(stdout, "+  %s\n", entry.URL)
+			added++
+		case !previous.Checksum.matches(entry.Checksum):
+			fmt.Fprintf(stdout, "~  %s\n", entry.URL)
+			updated++
+		default:
+			unchanged++
+		}
+	}
+	fmt.Fprintf(stdout, "Mirror of %s: %d added, %d updated, %d removed, %d unchanged.\n",
+		opts.OutputDir, added, updated, len(removed)-failed, unchanged)
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d files could not be moved.\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// fetchSDSCount fetches the first search result page of country and returns the number of
+// SDS sheets the search currently lists, see parseSDSCount.
+func fetchSDSCount(ctx context.Context, client *http.Client, robots *robotstxt.RobotsData, country string) (int, error) {
+	pageURL := searchPageURL(country, 0, documentsPerPage)
+	if !robotsAllowed(robots, pageURL) {
+		return 0, errRobotsDisallowed
+	}
+	pageHTML, err := fetchPageHTML(ctx, client, pageURL, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	return parseSDSCount(pageHTML)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"             // Captured report
+	"context"           // Running the syncs
+	"fmt"               // Result count and PDF names
+	"io"                // Mock server answers
+	"log"               // Silencing the sync log
+	"net/http"          // Mock search handler
+	"net/http/httptest" // Built-in mock server
+	"os"                // Page copies
+	"path/filepath"     // Output paths
+	"strconv"           // Page offsets
+	"strings"           // Checking the report
+	"sync/atomic"       // Documents listed by the mock site
+	"testing"           // Test framework
+	"time"              // PDF timeout
+)
+
+func TestSyncMirrorSDSCount(t *testing.T) {
+	// A site listing total documents on pages of ten, with the results count on every page
+	var total atomic.Int64
+	total.Store(30)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sds-search", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		var links []SDSLink
+		for document := offset; document < min(offset+documentsPerPage, int(total.Load())); document++ {
+			links = append(links, SDSLink{URL: fmt.Sprintf("http://%s/-/media/sds/sheet-%d.pdf", r.Host, document), Language: "en"})
+		}
+		page, err := renderResultCards(links, "http://"+r.Host+r.URL.RequestURI())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `<p class="sds-results-count">Showing %d-%d of %d results</p>%s`, offset+1, offset+len(links), total.Load(), page)
+	})
+	mux.HandleFunc("/-/media/sds/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testPDF)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	useBaseURL(t, server.URL+"/sds-search")
+	previousLogOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(previousLogOutput) })
+
+	dir := t.TempDir()
+	stats := &Statistics{}
+	htmlClient, pdfClient, err := newScraperClients(tlsOptions{}, time.Minute, stats, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync := func() string {
+		t.Helper()
+		var stdout bytes.Buffer
+		opts := mirrorOptions{OutputDir: dir, Country: "United States", IgnoreRobots: true, HTMLClient: htmlClient, PDFClient: pdfClient, Stats: stats, Output: &stdout}
+		if code := syncMirror(context.Background(), opts); code != 0 {
+			t.Fatalf("syncMirror exit code = %d, report:\n%s", code, stdout.String())
+		}
+		return stdout.String()
+	}
+	// Only the pages of the current count are scraped
+	if report := sync(); !strings.Contains(report, "30 added, 0 updated, 0 removed") {
+		t.Errorf("first sync report:\n%s", report)
+	}
+	copies, _ := filepath.Glob(filepath.Join(dir, "pages", "*"+snapshotPageSuffix))
+	if len(copies) != 3 {
+		t.Errorf("first sync kept %d page copies, want 3", len(copies))
+	}
+	// The copy of the page past the new last one is dropped, so its documents are purged
+	total.Store(20)
+	if report := sync(); !strings.Contains(report, "0 added, 0 updated, 10 removed, 20 unchanged") {
+		t.Errorf("sync after the count dropped, report:\n%s", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pages", "20"+snapshotPageSuffix)); !os.IsNotExist(err) {
+		t.Errorf("copy of the removed page kept: %v", err)
+	}
+}
+
+func TestParseSDSCount(t *testing.T) {
+	fixture, err := os.ReadFile(searchResultsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		page    string
+		want    int
+		wantErr bool
+	}{
+		{"fixture", string(fixture), 12700, false},
+		{"without separators", `<p class="sds-results-count">Showing 1-10 of 95 results</p>`, 95, false},
+		{"no results count", `<div class="sds-results"></div>`, 0, true},
+		{"no total", `<p class="sds-results-count">No results</p>`, 0, true},
+		{"zero results", `<p class="sds-results-count">Showing 0-0 of 0 results</p>`, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			count, err := parseSDSCount(test.page)
+			if (err != nil) != test.wantErr || count != test.want {
+				t.Errorf("parseSDSCount = %d, %v, want %d (error %t)", count, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json" // JSON encoding of the sidecar file
+	"errors"        // Sentinel errors
+	"fmt"           // Formatting for error messages
+	"net/http"      // HTTP headers
+	"net/url"       // Page offsets of the cached URLs
+	"os"            // File operations
+	"path/filepath" // Path manipulation
+	"strconv"       // Parsing the page offsets
+	"sync"          // Mutex guarding the cache
+)
+
+// errPageNotModified is returned by fetchPageHTML when the server answers 304 Not Modified.
+var errPageNotModified = errors.New("page not modified since last scrape")
+
+// pageValidators holds the caching headers returned for a previously scraped page or downloaded PDF.
+type pageValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validatorsFromHeader reads the validators from the headers of a response.
+func validatorsFromHeader(header http.Header) pageValidators {
+	return pageValidators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+}
+
+// applyTo makes req conditional with If-None-Match / If-Modified-Since headers.
+func (validators pageValidators) applyTo(req *http.Request) {
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+}
+
+// pageCache remembers the validators of every scraped page URL so later runs
+// can send conditional requests. It is safe for concurrent use.
+type pageCache struct {
+	mutex sync.Mutex
+	path  string                    // Location of the sidecar JSON file
+	pages map[string]pageValidators // Validators keyed by page URL
+}
+
+// loadPageCache reads the sidecar file at path. A missing or unreadable file yields an empty cache.
+func loadPageCache(path string) *pageCache {
+	cache := &pageCache{path: path, pages: make(map[string]pageValidators)}
+	// Read the sidecar left by the previous run, if any
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cache // First run: nothing cached yet
+	}
+	// Ignore a corrupt sidecar; the pages are simply fetched in full again
+	if err := json.Unmarshal(content, &cache.pages); err != nil {
+		cache.pages = make(map[string]pageValidators)
+	}
+	return cache
+}
+
+// applyConditionalHeaders adds If-None-Match / If-Modified-Since headers for a cached page.
+func (cache *pageCache) applyConditionalHeaders(req *http.Request) {
+	cache.mutex.Lock()
+	validators, ok := cache.pages[req.URL.String()]
+	cache.mutex.Unlock()
+	if !ok {
+		return // Never scraped before
+	}
+	validators.applyTo(req)
+}
+
+// record stores the validators of a freshly fetched page.
+func (cache *pageCache) record(pageURL string, header http.Header) {
+	validators := validatorsFromHeader(header)
+	if validators == (pageValidators{}) {
+		return // The server sent no validators for this page
+	}
+	cache.mutex.Lock()
+	cache.pages[pageURL] = validators
+	cache.mutex.Unlock()
+}
+
+// forgetFrom drops the validators of the pages starting at offset total or later, e.g.
+// after the site listed fewer documents, and returns how many were dropped.
+func (cache *pageCache) forgetFrom(total int) int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	forgotten := 0
+	for pageURL := range cache.pages {
+		parsed, err := url.Parse(pageURL)
+		if err != nil {
+			continue
+		}
+		if offset, err := strconv.Atoi(parsed.Query().Get("first")); err == nil && offset >= total {
+			delete(cache.pages, pageURL)
+			forgotten++
+		}
+	}
+	return forgotten
+}
+
+// save writes the cache back to its sidecar file, creating the parent directory if needed.
+func (cache *pageCache) save() error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if err := ensureDir(0755, filepath.Dir(cache.path)); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(cache.pages, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding page cache: %w", err)
+	}
+	if err := os.WriteFile(cache.path, content, 0644); err != nil {
+		return fmt.Errorf("error writing page cache %s: %w", cache.path, err)
+	}
+	return nil
+}
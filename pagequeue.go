@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/heap" // Priority queue of the pages
+	"context"        // Cancelling the wait
+	"sync"           // Serializing the page dispatches
+	"time"           // Delay between the page fetches
+)
+
+// maxPageAttempts is how often a page is fetched in one scrape before it is recorded in
+// failed-pages.txt; pages failing with a non-retryable error (e.g. 404) are fetched once.
+const maxPageAttempts = 3
+
+// pageQueueItem is a search result page waiting to be scraped.
+type pageQueueItem struct {
+	pageIndex int // Zero-based number of the page
+	failures  int // Failed fetches of the page, in the previous run and this one
+	attempts  int // Fetches of the page in this run
+}
+
+// pageQueue is a heap.Interface of the pages to scrape: pages that failed before come
+// first, the most failures first, then the pages in ascending order. Failed pages are
+// thus retried between the fresh pages instead of in a batch after all of them.
+type pageQueue []pageQueueItem
+
+func (queue pageQueue) Len() int { return len(queue) }
+
+func (queue pageQueue) Less(i, j int) bool {
+	if queue[i].failures != queue[j].failures {
+		return queue[i].failures > queue[j].failures
+	}
+	return queue[i].pageIndex < queue[j].pageIndex
+}
+
+func (queue pageQueue) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *pageQueue) Push(item any) { *queue = append(*queue, item.(pageQueueItem)) }
+
+func (queue *pageQueue) Pop() any {
+	old := *queue
+	item := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return item
+}
+
+// newPageQueue queues pageIndexes, giving the pages listed in previousFailures (page
+// indexes that failed in the previous run) priority over the others.
+func newPageQueue(pageIndexes []int, previousFailures []int) *pageQueue {
+	failed := make(map[int]bool, len(previousFailures))
+	for _, pageIndex := range previousFailures {
+		failed[pageIndex] = true
+	}
+	queue := make(pageQueue, 0, len(pageIndexes))
+	for _, pageIndex := range pageIndexes {
+		item := pageQueueItem{pageIndex: pageIndex}
+		if failed[pageIndex] {
+			item.failures = 1
+		}
+		queue = append(queue, item)
+	}
+	heap.Init(&queue)
+	return &queue
+}
+
+// pageThrottle enforces a minimum delay between any two page fetches for --page-delay,
+// across all goroutines and countries sharing it, on top of the concurrency semaphore.
+type pageThrottle struct {
+	mutex  sync.Mutex    // Lets one dispatch at a time wait for the ticker
+	ticker *time.Ticker  // Ticks once the delay since the last dispatch has passed
+	delay  time.Duration // Minimum delay between two page fetches
+}
+
+// newPageThrottle returns a throttle letting a page be fetched every delay, or nil (no
+// throttling) for a delay of 0. Stop it when the scrape is done.
+func newPageThrottle(delay time.Duration) *pageThrottle {
+	if delay <= 0 {
+		return nil
+	}
+	return &pageThrottle{ticker: time.NewTicker(delay), delay: delay}
+}
+
+// wait blocks until the next page may be fetched or ctx is cancelled; the first page
+// waits one delay as well. The ticker is reset by every dispatch, so a tick that was not
+// waited for never lets two pages through at once. A nil throttle never blocks.
+func (throttle *pageThrottle) wait(ctx context.Context) error {
+	if throttle == nil {
+		return nil
+	}
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	select {
+	case <-throttle.ticker.C:
+		throttle.ticker.Reset(throttle.delay) // Count the delay from this dispatch
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop releases the ticker of the throttle. A nil throttle does nothing.
+func (throttle *pageThrottle) stop() {
+	if throttle != nil {
+		throttle.ticker.Stop()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"     // Error formatting
+	"os"      // Atomic replacement of the file
+	"strings" // Trimming the printed dates
+	"time"    // Revision date parsing
+
+	"github.com/parquet-go/parquet-go" // Parquet encoding
+)
+
+// parquetFileName is the Parquet export written next to manifest.json with --output-format parquet.
+const parquetFileName = "manifest.parquet"
+
+// revisionDateLayouts are the date formats printed on the SDS cards of the supported countries.
+var revisionDateLayouts = []string{
+	"2006-01-02",
+	"01/02/2006",
+	"02.01.2006",
+	"2 January 2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 Jan 2006",
+}
+
+// parseRevisionDate parses a revision date as printed on an SDS card; ok is false for
+// dates in none of revisionDateLayouts.
+func parseRevisionDate(value string) (date time.Time, ok bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range revisionDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parquetRow is a row of the Parquet export, one per SDS link. Spark and BigQuery read
+// revision_date as epoch milliseconds; it is null when the printed date is not understood.
+type parquetRow struct {
+	URL          string `parquet:"url"`
+	ProductName  string `parquet:"product_name"`
+	CASNumber    string `parquet:"cas_number"`
+	RevisionDate *int64 `parquet:"revision_date,optional"`
+	Language     string `parquet:"language"`
+	SHA256       string `parquet:"sha256"`    // Empty for links that were not downloaded or hashed with another --checksum-algo
+	FilePath     string `parquet:"file_path"` // Empty for links that were not downloaded or streamed to S3
+}
+
+// newParquetRows describes every link as a row, with the checksum and local path of the
+// PDF when the manifest records its download.
+func newParquetRows(links []SDSLink, manifest *Manifest) []parquetRow {
+	rows := make([]parquetRow, 0, len(links))
+	for _, link := range links {
+		row := parquetRow{
+			URL:         link.URL,
+			ProductName: link.ProductName,
+			CASNumber:   link.CASNumber,
+			Language:    link.Language,
+		}
+		if date, ok := parseRevisionDate(link.RevisionDate); ok {
+			millis := date.UnixMilli()
+			row.RevisionDate = &millis
+		}
+		if entry := manifest.find(link.URL); entry != nil {
+			row.SHA256 = entry.Checksum.sha256()
+			row.FilePath = entry.FilePath
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeParquet writes the links and their downloads to the Parquet file at path,
+// replacing the previous version atomically.
+func writeParquet(path string, links []SDSLink, manifest *Manifest) error {
+	// Write to a temporary file first so readers never see a truncated file
+	temporaryPath := path + ".tmp"
+	if err := parquet.WriteFile(temporaryPath, newParquetRows(links, manifest)); err != nil {
+		os.Remove(temporaryPath)
+		return fmt.Errorf("error writing Parquet file %s: %w", temporaryPath, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf("error replacing Parquet file %s: %w", path, err)
+	}
+	return nil
+}
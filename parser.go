@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt" // Error formatting
+	"io"  // Parser input
+	"log" // Logging parse errors
+)
+
+// Parser extracts the PDF links and their card metadata from scraped search result pages.
+// r may hold several concatenated pages; pageURL is the URL they were fetched from ("" =
+// unknown) and becomes the SourceURL of links whose page has no canonical URL. The links
+// are returned as found, see cleanExtractedLinks.
+type Parser interface {
+	Parse(r io.Reader, pageURL string) ([]SDSLink, error)
+}
+
+// TokenizerParser streams the pages through an html.Tokenizer, holding only the current
+// card in memory, see extractLinksFromReader. It is the default parser.
+type TokenizerParser struct{}
+
+// Parse implements Parser.
+func (TokenizerParser) Parse(r io.Reader, pageURL string) ([]SDSLink, error) {
+	links, err := extractLinksFromReader(r)
+	return withSourceURL(links, pageURL), err
+}
+
+// NodeTreeParser parses every page into a node tree with html.Parse, see extractPageLinks.
+// It reads all pages into memory, but recovers from malformed markup like a browser.
+type NodeTreeParser struct{}
+
+// Parse implements Parser. Parse errors of single pages are logged with their byte
+// offset; only a failure to read r is returned.
+func (NodeTreeParser) Parse(r io.Reader, pageURL string) ([]SDSLink, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading HTML: %w", err)
+	}
+	var links []SDSLink
+	offset := 0 // Byte offset of the page in input, for the parse errors
+	for _, page := range splitHTMLPages(string(input)) {
+		pageLinks, err := extractPageLinks(page, offset)
+		if err != nil {
+			log.Println(err)
+		}
+		links = append(links, pageLinks...)
+		offset += len(page)
+	}
+	return withSourceURL(links, pageURL), nil
+}
+
+// withSourceURL records pageURL as the SourceURL of the links that have none.
+func withSourceURL(links []SDSLink, pageURL string) []SDSLink {
+	if pageURL == "" {
+		return links
+	}
+	for index := range links {
+		if links[index].SourceURL == "" {
+			links[index].SourceURL = pageURL
+		}
+	}
+	return links
+}
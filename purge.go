@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the summary
+	"io"            // Summary output
+	"log"           // Logging errors
+	"os"            // Moving files
+	"path/filepath" // Path manipulation
+	"strings"       // Splitting the dead links file
+)
+
+// trashDirName is the folder, inside the PDFs folder, receiving purged files.
+const trashDirName = ".trash"
+
+// runPurge implements the "purge" subcommand: every PDF listed in the previous manifest
+// but no longer in the current one is moved into PDFs/.trash/ (never deleted).
+// With --dead-links the PDFs of the URLs listed by check-links are purged instead.
+// It returns the process exit code.
+func runPurge(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	oldPath := flags.String("old", "", "manifest of the previous run (required)")
+	newPath := flags.String("new", "manifest.json", "manifest of the current run")
+	deadLinksPath := flags.String("dead-links", "", "purge the PDFs of the URLs in this file written by check-links, and remove them from --new, instead of comparing manifests")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+	if *deadLinksPath != "" {
+		return purgeDeadLinks(stdout, *deadLinksPath, *newPath)
+	}
+	if *oldPath == "" {
+		log.Println("purge: --old is required")
+		flags.Usage()
+		return 2
+	}
+
+	// Load both manifests
+	oldManifest, err := loadManifest(*oldPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	newManifest, err := loadManifest(*newPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	// Index what is still listed on the site
+	currentURLs := make(map[string]bool)
+	currentFiles := make(map[string]bool)
+	for _, entry := range newManifest.Entries {
+		currentURLs[entry.URL] = true
+		currentFiles[entry.FilePath] = true
+	}
+	// Move every file that disappeared from the site into the trash
+	purged, failed := 0, 0
+	var purgedBytes int64
+	for _, entry := range oldManifest.Entries {
+		if currentURLs[entry.URL] || currentFiles[entry.FilePath] || !fileExists(entry.FilePath) {
+			continue // Still listed, shared with a current entry, or already gone
+		}
+		trashPath, err := moveToTrash(entry.FilePath)
+		if err != nil {
+			log.Println("Error purging file:", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "PURGED  %s -> %s\n", entry.FilePath, trashPath)
+		purged++
+		purgedBytes += entry.Size
+	}
+	fmt.Fprintf(stdout, "Purged %d files (%s) no longer listed on the site.\n", purged, formatBytes(purgedBytes))
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d files could not be moved.\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// purgeDeadLinks moves the PDF of every URL listed in deadLinksPath into the trash and
+// removes its entry from the manifest, printing every purged file to stdout. It returns
+// the process exit code.
+func purgeDeadLinks(stdout io.Writer, deadLinksPath string, manifestPath string) int {
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	content, err := os.ReadFile(deadLinksPath)
+	if err != nil {
+		log.Println("Error reading dead links:", err)
+		return 1
+	}
+	purged, failed := 0, 0
+	var purgedBytes int64
+	for _, deadLink := range strings.Fields(string(content)) {
+		entry := manifest.find(deadLink)
+		if entry == nil {
+			continue // Already purged
+		}
+		if fileExists(entry.FilePath) {
+			trashPath, err := moveToTrash(entry.FilePath)
+			if err != nil {
+				log.Println("Error purging file:", err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(stdout, "PURGED  %s -> %s\n", entry.FilePath, trashPath)
+			purged++
+			purgedBytes += entry.Size
+		}
+		manifest.remove(deadLink)
+	}
+	if err := manifest.save(manifestPath); err != nil {
+		log.Println(err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Purged %d files (%s) of dead links.\n", purged, formatBytes(purgedBytes))
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d files could not be moved.\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// moveToTrash moves the file into the .trash folder next to it and returns its new path.
+func moveToTrash(filePath string) (string, error) {
+	trashDir := filepath.Join(filepath.Dir(filePath), trashDirName)
+	if err := ensureDir(0755, trashDir); err != nil {
+		return "", err
+	}
+	trashPath := filepath.Join(trashDir, filepath.Base(filePath))
+	if err := os.Rename(filePath, trashPath); err != nil {
+		return "", fmt.Errorf("error moving %s to %s: %w", filePath, trashPath, err)
+	}
+	return trashPath, nil
+}
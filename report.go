@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"           // Sorting the categories
+	"fmt"           // Error formatting
+	"html/template" // Escaped HTML output
+	"os"            // Writing the report
+	"path/filepath" // Manifest paths
+	"slices"        // Sorting
+	"sort"          // Sorting the countries
+	"time"          // Run timestamp
+)
+
+// reportFileName is the HTML report written by --report html.
+const reportFileName = "report.html"
+
+// reportCategory is one row of the category breakdown.
+type reportCategory struct {
+	Name  string // Category shown on the SDS cards ("" = none)
+	Count int    // Downloaded PDFs in the category
+}
+
+// reportPDF is one row of the table of downloaded PDFs.
+type reportPDF struct {
+	Country string // Country the PDF was scraped for
+	ManifestEntry
+}
+
+// reportData is what the report template renders.
+type reportData struct {
+	Generated      time.Time        // When the report was written
+	Started        time.Time        // When the run started
+	Duration       time.Duration    // Duration of the run
+	PagesScraped   int64            // Search result pages fetched and saved
+	PDFsDownloaded int64            // PDFs written to disk by the run
+	Bytes          string           // Size of the PDFs written by the run
+	Skipped        int64            // Pages and PDFs skipped
+	PageErrors     int64            // Failed page fetches
+	DownloadErrors int64            // Failed PDF downloads
+	Categories     []reportCategory // Downloaded PDFs by category, largest first
+	PDFs           []reportPDF      // Every PDF in the manifests of the run's countries
+}
+
+// reportTemplate renders a self-contained page: the CSS and the table filter are inline.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Ecolab SDS scrape report {{.Started.Format "2006-01-02 15:04"}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+td.number { text-align: right; }
+.errors { color: #b00; }
+#filter { padding: 0.4em; width: 30em; margin-bottom: 0.8em; }
+</style>
+</head>
+<body>
+<h1>Ecolab SDS scrape report</h1>
+<p>Run started {{.Started.Format "2006-01-02 15:04:05 MST"}}, took {{.Duration}}; report generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Pages scraped</th><td class="number">{{.PagesScraped}}</td></tr>
+<tr><th>PDFs downloaded</th><td class="number">{{.PDFsDownloaded}} ({{.Bytes}})</td></tr>
+<tr><th>Skipped</th><td class="number">{{.Skipped}}</td></tr>
+</table>
+
+<h2>Errors by type</h2>
+<table>
+<tr><th>Page fetches</th><td class="number{{if .PageErrors}} errors{{end}}">{{.PageErrors}}</td></tr>
+<tr><th>PDF downloads</th><td class="number{{if .DownloadErrors}} errors{{end}}">{{.DownloadErrors}}</td></tr>
+</table>
+
+<h2>Categories</h2>
+<table>
+<tr><th>Category</th><th>PDFs</th></tr>
+{{range .Categories}}<tr><td>{{if .Name}}{{.Name}}{{else}}<em>none</em>{{end}}</td><td class="number">{{.Count}}</td></tr>
+{{end}}</table>
+
+<h2>Downloaded PDFs ({{len .PDFs}})</h2>
+<input id="filter" type="search" placeholder="Filter by product, CAS number, language, category…">
+<table id="pdfs">
+<thead><tr><th>Country</th><th>Product</th><th>CAS number</th><th>Language</th><th>Category</th><th>Revision</th><th>Size</th><th>File</th></tr></thead>
+<tbody>
+{{range .PDFs}}<tr><td>{{.Country}}</td><td>{{.ProductName}}</td><td>{{.CASNumber}}</td><td>{{.Language}}</td><td>{{.Category}}</td><td>{{.RevisionDate}}</td><td class="number">{{bytes .Size}}</td><td><a href="{{.URL}}">{{.FilePath}}</a></td></tr>
+{{end}}</tbody>
+</table>
+<script>
+document.getElementById("filter").addEventListener("input", function () {
+  var query = this.value.toLowerCase();
+  document.querySelectorAll("#pdfs tbody tr").forEach(function (row) {
+    row.style.display = row.textContent.toLowerCase().indexOf(query) === -1 ? "none" : "";
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTMLReport renders the statistics of the run and the manifests of its countries
+// into path.
+func writeHTMLReport(path string, stats *Statistics, started time.Time, countryDirs map[string]string) error {
+	data := reportData{
+		Generated:      time.Now(),
+		Started:        started,
+		Duration:       time.Since(started).Round(time.Second),
+		PagesScraped:   stats.PagesScraped.Load(),
+		PDFsDownloaded: stats.PDFsDownloaded.Load(),
+		Bytes:          formatBytes(stats.BytesDownloaded.Load()),
+		Skipped:        stats.Skipped.Load(),
+		PageErrors:     stats.Errors.Load() - stats.DownloadErrors.Load(),
+		DownloadErrors: stats.DownloadErrors.Load(),
+	}
+	// List the PDFs of every country, in a stable order
+	countries := make([]string, 0, len(countryDirs))
+	for country := range countryDirs {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	byCategory := make(map[string]int)
+	for _, country := range countries {
+		manifest, err := loadManifest(filepath.Join(countryDirs[country], "manifest.json"))
+		if err != nil {
+			return err
+		}
+		for _, entry := range manifest.Entries {
+			data.PDFs = append(data.PDFs, reportPDF{Country: country, ManifestEntry: entry})
+			byCategory[entry.Category]++
+		}
+	}
+	for name, count := range byCategory {
+		data.Categories = append(data.Categories, reportCategory{Name: name, Count: count})
+	}
+	slices.SortFunc(data.Categories, func(a, b reportCategory) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name)) // Largest first
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report %s: %w", path, err)
+	}
+	if err := reportTemplate.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing report %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing report %s: %w", path, err)
+	}
+	return nil
+}
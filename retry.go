@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"      // Cancelling the wait
+	"log/slog"     // Logging the retries
+	"math/rand/v2" // Jitter of the retry delay
+	"net/http"     // HTTP date parsing
+	"strconv"      // Delta-seconds parsing
+	"strings"      // Header trimming
+	"time"         // Delays
+)
+
+// Limits of the retries of rate limited requests.
+const (
+	maxRateLimitRetries = 3               // Retries of a page answered with 429 Too Many Requests
+	defaultRetryAfter   = 5 * time.Second // Delay when the server sends no usable Retry-After header
+	maxRetryAfter       = 5 * time.Minute // Longest delay honoured, so a bogus header cannot stall the scrape
+	retryJitter         = 1 * time.Second // Random delay added so the waiting requests don't retry at once
+)
+
+// Limits of the retries of pages answered with 503 Service Unavailable, e.g. during CDN
+// maintenance windows.
+const (
+	maxUnavailableRetries = 5               // Retries of a page answered with 503 Service Unavailable
+	unavailableBaseDelay  = 2 * time.Second // First delay without Retry-After, doubled on every retry
+	unavailableJitter     = 0.25            // Fraction of the delay added or removed at random
+)
+
+// retryAfterDelay returns how long to wait according to a Retry-After header value,
+// which is either a number of seconds or an HTTP date.
+func retryAfterDelay(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	delay := defaultRetryAfter
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+	}
+	return min(max(delay, 0), maxRetryAfter)
+}
+
+// sleepWithJitter waits for delay plus a random jitter, returning early with the
+// context's error when ctx is cancelled.
+func sleepWithJitter(ctx context.Context, delay time.Duration) error {
+	return sleepContext(ctx, delay+rand.N(retryJitter))
+}
+
+// unavailableDelay returns how long to wait before retry number attempt (zero-based) of a
+// page answered with 503: the Retry-After header when the server sends one, otherwise an
+// exponential backoff from unavailableBaseDelay. Either is varied by ±unavailableJitter.
+func unavailableDelay(retryAfter string, attempt int, now time.Time) time.Duration {
+	delay := min(unavailableBaseDelay<<attempt, maxRetryAfter)
+	if strings.TrimSpace(retryAfter) != "" {
+		delay = retryAfterDelay(retryAfter, now)
+	}
+	spread := time.Duration(float64(delay) * unavailableJitter)
+	if spread <= 0 {
+		return delay
+	}
+	return delay - spread + rand.N(2*spread)
+}
+
+// sleepContext waits for delay, returning early with the context's error when ctx is cancelled.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// doWithUnavailableRetries sends a request without a body like doWithRateLimitRetries,
+// and also waits and retries up to maxUnavailableRetries times while the server answers
+// 503 Service Unavailable. The last response is returned, whatever its status.
+func doWithUnavailableRetries(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := doWithRateLimitRetries(ctx, client, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || attempt == maxUnavailableRetries {
+			return resp, nil
+		}
+		// Back off, the server is likely down for maintenance
+		resp.Body.Close()
+		delay := unavailableDelay(resp.Header.Get("Retry-After"), attempt, time.Now())
+		slog.Warn("Service unavailable, retrying", "url", req.URL.String(), "delay", delay, "attempt", attempt+1, "max_attempts", maxUnavailableRetries)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// doWithRateLimitRetries sends a request without a body, waiting and retrying up to
+// maxRateLimitRetries times while the server answers 429 Too Many Requests. The last
+// response is returned, whatever its status.
+func doWithRateLimitRetries(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, nil
+		}
+		// Wait as long as the server asks before trying again
+		resp.Body.Close()
+		delay := retryAfterDelay(resp.Header.Get("Retry-After"), time.Now())
+		slog.Warn("Rate limited, retrying", "url", req.URL.String(), "delay", delay, "attempt", attempt+1)
+		if err := sleepWithJitter(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http" // HTTP-date formatting
+	"testing"  // Test framework
+	"time"     // Delays and dates
+)
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	httpDate := func(offset time.Duration) string { return now.Add(offset).Format(http.TimeFormat) }
+	tests := []struct {
+		name  string
+		value string // Retry-After header
+		want  time.Duration
+	}{
+		// Delay in seconds
+		{"seconds", "120", 2 * time.Minute},
+		{"seconds with spaces", " 30 ", 30 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"seconds over the limit", "86400", maxRetryAfter},
+		// HTTP date
+		{"date", httpDate(90 * time.Second), 90 * time.Second},
+		{"RFC 850 date", now.Add(time.Minute).Format(time.RFC850), time.Minute},
+		{"ANSI C date", now.Add(2 * time.Minute).Format(time.ANSIC), 2 * time.Minute},
+		{"date in the past", httpDate(-time.Hour), 0},
+		{"date over the limit", httpDate(24 * time.Hour), maxRetryAfter},
+		// Neither
+		{"empty", "", defaultRetryAfter},
+		{"garbage", "soon", defaultRetryAfter},
+		{"fractional seconds", "1.5", defaultRetryAfter},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryAfterDelay(test.value, now); got != test.want {
+				t.Errorf("retryAfterDelay(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnavailableDelay(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration // Delay before the jitter
+	}{
+		{"first attempt", "", 0, unavailableBaseDelay},
+		{"third attempt", "", 2, 4 * unavailableBaseDelay},
+		{"backoff over the limit", "", 10, maxRetryAfter},
+		{"Retry-After seconds", "60", 3, time.Minute},
+		{"Retry-After date", now.Add(40 * time.Second).Format(http.TimeFormat), 0, 40 * time.Second},
+		{"Retry-After in the past", now.Add(-time.Minute).Format(http.TimeFormat), 5, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spread := time.Duration(float64(test.want) * unavailableJitter)
+			// The jitter is random, so check the bounds of many draws
+			for range 100 {
+				got := unavailableDelay(test.retryAfter, test.attempt, now)
+				if got < test.want-spread || got > test.want+spread {
+					t.Fatalf("unavailableDelay(%q, %d) = %v, want %v ± %v", test.retryAfter, test.attempt, got, test.want, spread)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json" // Validators sidecar file
+	"errors"        // Disallowed page error
+	"fmt"           // Formatting for error messages
+	"io"            // Reading the response body
+	"log/slog"      // Logging cache problems
+	"net/http"      // HTTP request for robots.txt
+	"net/url"       // URL parsing
+	"os"            // Cache files
+	"path/filepath" // Cache paths
+	"time"          // Cache expiry
+
+	"github.com/temoto/robotstxt" // robots.txt parsing and matching
+)
+
+// robotsUserAgent is the product token matched against the User-agent lines of robots.txt.
+const robotsUserAgent = "EcolabBot"
+
+// robotsCacheMaxAge is how long a cached robots.txt is revalidated with conditional requests;
+// older copies are downloaded again in full, even if the server claims they are unchanged.
+const robotsCacheMaxAge = 24 * time.Hour
+
+// robotsCacheEntry is the sidecar of the cached robots.txt: where it came from and its validators.
+type robotsCacheEntry struct {
+	URL string `json:"url"` // robots.txt the cached copy belongs to
+	pageValidators
+}
+
+// cacheFilePath returns $XDG_CACHE_HOME/ecolab-scraper/name (~/.cache when
+// XDG_CACHE_HOME is unset), or an empty string when no cache directory is available.
+func cacheFilePath(name string) string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		cacheHome = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheHome, "ecolab-scraper", name)
+}
+
+// robotsCachePath returns the path robots.txt is cached at, see cacheFilePath.
+func robotsCachePath() string {
+	return cacheFilePath("robots.txt")
+}
+
+// loadCachedRobotsTxt returns the cached robots.txt of robotsURL and its validators.
+// ok is false when nothing usable is cached or the copy is older than robotsCacheMaxAge.
+func loadCachedRobotsTxt(cachePath string, robotsURL string) (content []byte, entry robotsCacheEntry, ok bool) {
+	info, err := os.Stat(cachePath)
+	if err != nil || time.Since(info.ModTime()) > robotsCacheMaxAge {
+		return nil, entry, false // Not cached yet, or expired
+	}
+	sidecar, err := os.ReadFile(cachePath + ".etag")
+	if err != nil || json.Unmarshal(sidecar, &entry) != nil || entry.URL != robotsURL {
+		return nil, entry, false // No validators, or the copy of another site
+	}
+	if content, err = os.ReadFile(cachePath); err != nil {
+		return nil, entry, false
+	}
+	return content, entry, true
+}
+
+// saveCachedRobotsTxt stores a freshly downloaded robots.txt with its validators.
+func saveCachedRobotsTxt(cachePath string, content []byte, entry robotsCacheEntry) error {
+	if err := ensureDir(0755, filepath.Dir(cachePath)); err != nil {
+		return err
+	}
+	sidecar, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding robots.txt validators: %w", err)
+	}
+	if err := os.WriteFile(cachePath, content, 0644); err != nil {
+		return fmt.Errorf("error writing robots.txt cache %s: %w", cachePath, err)
+	}
+	if err := os.WriteFile(cachePath+".etag", sidecar, 0644); err != nil {
+		return fmt.Errorf("error writing robots.txt cache %s.etag: %w", cachePath, err)
+	}
+	return nil
+}
+
+// fetchAndParseRobotsTxt downloads and parses the robots.txt of the site at baseURL
+// (e.g. https://www.ecolab.com). A missing robots.txt allows everything. The file is
+// cached with its ETag / Last-Modified (see robotsCachePath) and revalidated with a
+// conditional request, so an unchanged robots.txt is not downloaded again.
+func fetchAndParseRobotsTxt(baseURL string) (*robotstxt.RobotsData, error) {
+	// robots.txt always lives at the root of the host
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %s: %w", baseURL, err)
+	}
+	robotsURL := parsed.Scheme + "://" + parsed.Host + "/robots.txt"
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", robotsURL, err)
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	// Only ask for the file again if it changed since it was cached
+	cachePath := robotsCachePath()
+	cached, cacheEntry, cacheOK := loadCachedRobotsTxt(cachePath, robotsURL)
+	if cacheOK {
+		cacheEntry.applyTo(req)
+	}
+	resp, err := newHTTPClient(htmlRequestTimeout).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GET %s: %w", robotsURL, err)
+	}
+	defer resp.Body.Close()
+	statusCode, content := resp.StatusCode, cached
+	if statusCode == http.StatusNotModified && cacheOK {
+		slog.Debug("robots.txt not modified, using the cached copy", "path", cachePath)
+		statusCode = http.StatusOK
+	} else if content, err = io.ReadAll(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", robotsURL, err)
+	}
+	// FromStatusAndBytes also applies the status code rules (4xx allows all, 5xx disallows all)
+	robots, err := robotstxt.FromStatusAndBytes(statusCode, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", robotsURL, err)
+	}
+	// Cache a freshly downloaded file for the next runs; a failure only costs a download
+	if resp.StatusCode == http.StatusOK && cachePath != "" {
+		entry := robotsCacheEntry{URL: robotsURL, pageValidators: validatorsFromHeader(resp.Header)}
+		if err := saveCachedRobotsTxt(cachePath, content, entry); err != nil {
+			slog.Warn("Could not cache robots.txt", "error", err)
+		}
+	}
+	return robots, nil
+}
+
+// errRobotsDisallowed reports a page that was not scraped because robots.txt disallows it.
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsAllowed reports whether robots permits fetching pageURL. A nil robots allows everything.
+func robotsAllowed(robots *robotstxt.RobotsData, pageURL string) bool {
+	if robots == nil {
+		return true // robots.txt is ignored or could not be fetched
+	}
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return true // Let the fetch itself report the invalid URL
+	}
+	return robots.TestAgent(parsed.RequestURI(), robotsUserAgent)
+}
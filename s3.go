@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"       // Cancellation of the uploads
+	"fmt"           // Formatting for error messages
+	"io"            // Streamed uploads
+	"os"            // Reading the files to upload
+	"path"          // Object key construction
+	"path/filepath" // Local path conversion
+
+	"github.com/aws/aws-sdk-go-v2/aws"                // SDK configuration values
+	"github.com/aws/aws-sdk-go-v2/config"             // Credentials and region from the environment
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager" // Multipart uploads
+	"github.com/aws/aws-sdk-go-v2/service/s3"         // S3 API client
+)
+
+// s3Uploader uploads downloaded PDFs to an S3 bucket or an S3-compatible object store.
+type s3Uploader struct {
+	uploader *manager.Uploader // Splits files larger than 5 MB into a multipart upload
+	bucket   string            // Bucket receiving the PDFs
+	prefix   string            // Key prefix of every uploaded PDF (may be empty)
+}
+
+// newS3Uploader creates an uploader for bucket. Credentials are read from the usual AWS
+// environment variables and files; region and endpoint override the configured ones
+// when not empty. A custom endpoint (e.g. MinIO) is addressed with path-style URLs.
+func newS3Uploader(ctx context.Context, bucket, prefix, region, endpoint string) (*s3Uploader, error) {
+	var loadOptions []func(*config.LoadOptions) error
+	if region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(region))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	client := s3.NewFromConfig(awsConfig, func(options *s3.Options) {
+		if endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+			options.UsePathStyle = true
+		}
+	})
+	return &s3Uploader{uploader: manager.NewUploader(client), bucket: bucket, prefix: prefix}, nil
+}
+
+// upload stores the file at filePath under the prefix, keeping its relative path,
+// and returns the object key.
+func (uploader *s3Uploader) upload(ctx context.Context, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+	key := uploader.keyFor(filePath)
+	_, err = uploader.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(uploader.bucket),
+		Key:         aws.String(key),
+		Body:        file,
+		ContentType: aws.String("application/pdf"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading %s to s3://%s/%s: %w", filePath, uploader.bucket, key, err)
+	}
+	return key, nil
+}
+
+// keyFor returns the object key of a PDF whose local path would be filePath, so streamed
+// and uploaded copies of the same PDF share their key.
+func (uploader *s3Uploader) keyFor(filePath string) string {
+	return path.Join(uploader.prefix, filepath.ToSlash(filepath.Clean(filePath)))
+}
+
+// uploadStream stores everything read from body under key, without a local file.
+// The manager splits bodies larger than 5 MB into a multipart upload.
+func (uploader *s3Uploader) uploadStream(ctx context.Context, key string, body io.Reader) error {
+	_, err := uploader.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(uploader.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String("application/pdf"),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading to s3://%s/%s: %w", uploader.bucket, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"  // Stopping the schedule
+	"fmt"      // Formatting for error messages
+	"log/slog" // Logging the next run time
+
+	"github.com/robfig/cron/v3" // Cron expression parsing and scheduling
+)
+
+// runScheduled runs the scraper on the given cron schedule (e.g. "0 2 * * *") until ctx
+// is cancelled. Every run is incremental with a snapshot of all pages, and a run still in
+// progress when the next one is due causes that next run to be skipped.
+func runScheduled(ctx context.Context, scraper *Scraper, spec string) error {
+	// Re-scrape only what changed since the previous run, writing the kept copies of the
+	// unchanged pages as well so the output always lists every document, like the mirror
+	scraper.Incremental = true
+	scraper.Snapshot = true
+	scheduler := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+	var entryID cron.EntryID
+	entryID, err := scheduler.AddFunc(spec, func() {
+		if err := scraper.Run(ctx); err != nil {
+			slog.Error("Scheduled run failed", "error", err)
+		}
+		slog.Info("Next run scheduled", "at", scheduler.Entry(entryID).Next)
+	})
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	scheduler.Start()
+	slog.Info("Scheduled runs", "schedule", spec, "next_run", scheduler.Entry(entryID).Next)
+	// Hold the process open until interrupted, then let a running job finish its cleanup
+	<-ctx.Done()
+	<-scheduler.Stop().Done()
+	slog.Info("Schedule stopped")
+	return nil
+}
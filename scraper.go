@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"       // Cancellation of the run
+	"fmt"           // Webhook error messages
+	"io"            // Output of the links
+	"log/slog"      // Structured logging
+	"net/http"      // HTTP clients
+	"path"          // Path manipulation
+	"path/filepath" // Absolute report path
+	"regexp"        // Product filter
+	"strings"       // Joining the scrape errors
+	"sync"          // Waiting for the country scrapes
+	"time"          // Run duration
+
+	"github.com/temoto/robotstxt" // robots.txt rules
+)
+
+// maxConcurrentRequests limits the requests in flight at once across all countries.
+const maxConcurrentRequests = 10
+
+// Scraper runs the scrape and download pipeline for one or more countries.
+// A Scraper can be run repeatedly, e.g. on a schedule.
+type Scraper struct {
+	CountryDirs          map[string]string     // Output directory of every country to scrape
+	HTMLClient           *http.Client          // Client fetching the search result pages (nil = default client)
+	UserAgents           []string              // User agents the search pages are requested with (empty = defaultUserAgent)
+	PDFClient            *http.Client          // Client downloading the PDFs, with its own timeout (nil = default client)
+	Robots               *robotstxt.RobotsData // Rules of the site's robots.txt (nil = not checked)
+	Stats                *Statistics           // Counters of the current run
+	MaxConsecutiveErrors int                   // Abort a country after this many page fetches fail in a row (0 = never)
+	Incremental          bool                  // Skip pages that did not change since the last run
+	RetryFailed          bool                  // Only scrape the pages listed in failed-pages.txt
+	StartPage            int                   // First page to scrape
+	PageSize             int                   // Documents per search result page (0 = documentsPerPage)
+	TotalDocuments       int                   // Documents listed by the search (0 = totalSDSDocuments)
+	PageDelay            time.Duration         // Minimum delay between any two page fetches (0 = none)
+	EndPage              int                   // Scrape the pages before this one (0 = up to the last page)
+	Force                bool                  // Scrape again even when a previous run completed
+	Compress             bool                  // Store the scraped HTML gzip-compressed
+	Snapshot             bool                  // Rebuild the scraped HTML from per-page copies, so it reflects the current site
+	Languages            []string              // Only download SDS sheets in these ISO 639-1 languages (empty = all)
+	Include              []string              // Only download PDFs whose file name matches all of these patterns
+	Exclude              []string              // Skip PDFs whose file name matches any of these patterns
+	StripParams          []string              // Query parameters (path.Match patterns) removed from the extracted links (empty = none)
+	ProductFilter        *regexp.Regexp        // Only download SDS sheets whose product name matches (nil = all)
+	CASPrefixes          []string              // Only download SDS sheets with a CAS number starting with one of these, without hyphens (empty = all)
+	Since                *Manifest             // Only download PDFs new or revised since this manifest (nil = all)
+	MaxPDFs              int                   // Maximum number of PDFs to download in total (0 = unlimited)
+	MaxFileSize          int64                 // Skip PDFs larger than this many bytes (0 = unlimited)
+	MinFileSize          int64                 // Delete downloads smaller than this many bytes as invalid (0 = no minimum)
+	ChecksumAlgo         string                // Checksum algorithm of the manifest ("" = sha256)
+	ParallelChunks       int                   // Download large PDFs in this many parallel Range requests (1 = disabled)
+	SlowDownload         time.Duration         // Warn about PDF downloads taking longer than this (0 = never)
+	S3                   *s3Uploader           // Uploads the downloaded PDFs (nil = no upload)
+	StreamToS3           bool                  // Stream the PDFs into S3 instead of downloading them (requires S3)
+	SQLite               *sqliteOutput         // Records the links and their download status (nil = no database)
+	OutputFormat         string                // How the extracted links are reported ("text", "ndjson", "parquet" or "excel")
+	Output               io.Writer             // Destination of the ndjson links (nil = os.Stdout)
+	Logger               *slog.Logger          // Structured logger for downloads (nil = slog.Default())
+	Webhook              *webhookNotifier      // Notified at the end of each phase (nil = no notification)
+	Slack                *slackNotifier        // Receives a summary of every run and failure alerts (nil = no notification)
+	Report               string                // Format of the report written after the run ("" = none, "html")
+	parser               Parser                // Extracts the links from the scraped pages (nil = TokenizerParser), see WithParser
+}
+
+// WithParser makes the scraper extract the links from the scraped pages with parser
+// instead of the default TokenizerParser, e.g. a NodeTreeParser or a parser returning
+// canned links in tests.
+func (scraper *Scraper) WithParser(parser Parser) *Scraper {
+	scraper.parser = parser
+	return scraper
+}
+
+// setup creates the clients and counters that were not provided. Search pages and PDFs
+// use separate clients, so a short page timeout never kills a large PDF download.
+func (scraper *Scraper) setup() {
+	if scraper.Stats == nil {
+		scraper.Stats = &Statistics{}
+	}
+	if scraper.HTMLClient == nil {
+		scraper.HTMLClient = withConnectionCounting(newHTTPClient(htmlRequestTimeout), scraper.Stats)
+	}
+	if scraper.PDFClient == nil {
+		scraper.PDFClient = withConnectionCounting(newHTTPClient(pdfRequestTimeout), scraper.Stats)
+	}
+}
+
+// Run scrapes all countries concurrently, then downloads the PDFs of every country
+// into its own directory and logs a summary of the run. Failed pages and downloads are
+// only logged and counted; an error is returned when the downloads had to be stopped.
+func (scraper *Scraper) Run(ctx context.Context) error {
+	scraper.setup()
+	// Count the work of both phases for the final summary
+	stats := scraper.Stats
+	stats.reset()
+	stats.setPhase(phaseScrape)
+	defer stats.setPhase(phaseIdle)
+	startTime := time.Now()
+	// Create one semaphore shared by all countries so the request limit is global
+	concurrencySemaphore := make(chan struct{}, maxConcurrentRequests)
+	// Space the page fetches of all countries by the page delay as well
+	throttle := newPageThrottle(scraper.PageDelay)
+	defer throttle.stop()
+	// Scrape all countries concurrently, collecting why countries were aborted for the webhook
+	var waitGroup sync.WaitGroup
+	var scrapeErrors []string
+	var scrapeErrorsMutex sync.Mutex
+	for country, outputDir := range scraper.CountryDirs {
+		// Make sure the country directory exists before writing into it
+		if err := ensureDir(0755, outputDir); err != nil {
+			slog.Error("Error creating country directory", "country", country, "dir", outputDir, "error", err)
+			continue
+		}
+		// Limit the scrape to the previously failed pages when retrying
+		var offsets []int
+		if scraper.RetryFailed {
+			failedOffsets, err := readFailedPages(path.Join(outputDir, failedPagesFileName))
+			if err != nil || len(failedOffsets) == 0 {
+				slog.Info("No failed pages to retry", "country", country)
+				continue
+			}
+			offsets = failedOffsets
+		}
+		waitGroup.Add(1)
+		go func(country string, outputDir string) {
+			defer waitGroup.Done()
+			// Start the scraping process
+			pageErrors, err := scrapeContentAndSaveToFile(ctx, path.Join(outputDir, "ecolab-com.html"), ScrapeOptions{
+				Country:              country,
+				MaxConsecutiveErrors: scraper.MaxConsecutiveErrors,
+				Semaphore:            concurrencySemaphore,
+				Throttle:             throttle,
+				Client:               scraper.HTMLClient,
+				UserAgents:           scraper.UserAgents,
+				Incremental:          scraper.Incremental,
+				Offsets:              offsets,
+				StartPage:            scraper.StartPage,
+				PageSize:             scraper.PageSize,
+				TotalDocuments:       scraper.TotalDocuments,
+				EndPage:              scraper.EndPage,
+				Force:                scraper.Force,
+				Compress:             scraper.Compress,
+				Snapshot:             scraper.Snapshot,
+				Robots:               scraper.Robots,
+				Stats:                stats,
+			}) // Call the function to scrape content and save it to a file
+			if err != nil {
+				slog.Error("Scraping aborted", "country", country, "error", err) // Log the abort reason and the unscraped page range
+				scrapeErrorsMutex.Lock()
+				scrapeErrors = append(scrapeErrors, fmt.Sprintf("%s: %v", country, err))
+				scrapeErrorsMutex.Unlock()
+			} else if len(pageErrors) > 0 {
+				// Report the pages that could not be scraped as a failure of the country
+				slog.Warn("Scraping completed with failed pages", "country", country, "failed_pages", len(pageErrors), "first_error", pageErrors[0].Error())
+				scrapeErrorsMutex.Lock()
+				scrapeErrors = append(scrapeErrors, fmt.Sprintf("%s: %d pages failed, first: %v", country, len(pageErrors), &pageErrors[0]))
+				scrapeErrorsMutex.Unlock()
+			} else {
+				slog.Info("Scraping completed successfully", "country", country) // Log completion message
+			}
+		}(country, outputDir)
+	}
+	// Wait for every country to finish scraping before downloading
+	waitGroup.Wait()
+	// Record when the scrape phase finished and how long it took
+	stats.LastScrapeUnix.Store(time.Now().Unix())
+	stats.ScrapeDuration.Store(int64(time.Since(startTime)))
+	scrapeSkipped := stats.Skipped.Load() // Skips of the download phase are counted on top
+	// Show whether the page requests reused their connections
+	scrapeRequests, scrapeConnections := stats.Requests.Load(), stats.NewConnections.Load()
+	logConnectionReuse(phaseScrape, scrapeRequests, scrapeConnections)
+	scraper.Webhook.notify(ctx, webhookPayload{
+		Phase:  "scrape",
+		Status: phaseStatus(ctx, len(scrapeErrors) > 0),
+		Counts: map[string]int64{
+			"pages_scraped": stats.PagesScraped.Load(),
+			"skipped":       scrapeSkipped,
+			"errors":        stats.Errors.Load(),
+		},
+		DurationMS: time.Since(startTime).Milliseconds(),
+		Errors:     scrapeErrors,
+	})
+	// Alert Slack right away instead of only after the downloads
+	if len(scrapeErrors) > 0 {
+		scraper.Slack.notifyAlert(ctx, stats, strings.Join(scrapeErrors, "\n"))
+	}
+	stats.setPhase(phaseDownload)
+	downloadStartTime := time.Now()
+	// Download the PDFs of every country into its own directory
+	remainingPDFs := scraper.MaxPDFs
+	var downloadAbort error // Why the downloads were stopped
+	for country, outputDir := range scraper.CountryDirs {
+		if ctx.Err() != nil {
+			break // The run was interrupted
+		}
+		downloaded, err := downloadScrapedPDFs(ctx, outputDir, DownloadOptions{
+			Client:         scraper.PDFClient,
+			Languages:      scraper.Languages,
+			Include:        scraper.Include,
+			Exclude:        scraper.Exclude,
+			Parser:         scraper.parser,
+			StripParams:    scraper.StripParams,
+			ProductFilter:  scraper.ProductFilter,
+			CASPrefixes:    scraper.CASPrefixes,
+			Since:          scraper.Since,
+			MaxPDFs:        remainingPDFs,
+			MaxFileSize:    scraper.MaxFileSize,
+			MinFileSize:    scraper.MinFileSize,
+			ChecksumAlgo:   scraper.ChecksumAlgo,
+			ParallelChunks: scraper.ParallelChunks,
+			SlowDownload:   scraper.SlowDownload,
+			S3:             scraper.S3,
+			StreamToS3:     scraper.StreamToS3,
+			SQLite:         scraper.SQLite,
+			Country:        country,
+			OutputFormat:   scraper.OutputFormat,
+			Output:         scraper.Output,
+			Stats:          stats,
+			Logger:         scraper.Logger,
+		})
+		if err != nil {
+			slog.Error("Downloads aborted", "country", country, "error", err)
+			downloadAbort = fmt.Errorf("%s: %w", country, err)
+			break
+		}
+		// Share the download limit across all countries
+		if scraper.MaxPDFs > 0 {
+			remainingPDFs -= downloaded
+			if remainingPDFs <= 0 {
+				slog.Info("Reached the PDF limit, stopping downloads", "max_pdfs", scraper.MaxPDFs)
+				break
+			}
+		}
+	}
+	logConnectionReuse(phaseDownload, stats.Requests.Load()-scrapeRequests, stats.NewConnections.Load()-scrapeConnections)
+	downloadErrors := stats.DownloadErrors.Load()
+	var downloadErrorMessages []string
+	if downloadErrors > 0 { // The individual failures are in the log
+		downloadErrorMessages = append(downloadErrorMessages, fmt.Sprintf("%d PDF downloads failed", downloadErrors))
+	}
+	if downloadAbort != nil {
+		downloadErrorMessages = append(downloadErrorMessages, downloadAbort.Error())
+	}
+	scraper.Webhook.notify(ctx, webhookPayload{
+		Phase:  "download",
+		Status: phaseStatus(ctx, downloadErrors > 0 || downloadAbort != nil),
+		Counts: map[string]int64{
+			"pdfs_total":       stats.PDFsTotal.Load(),
+			"pdfs_downloaded":  stats.PDFsDownloaded.Load(),
+			"bytes_downloaded": stats.BytesDownloaded.Load(),
+			"skipped":          stats.Skipped.Load() - scrapeSkipped,
+			"errors":           downloadErrors,
+		},
+		DurationMS: time.Since(downloadStartTime).Milliseconds(),
+		Errors:     downloadErrorMessages,
+	})
+	// Summarize both phases
+	slog.Info(stats.summary(time.Since(startTime)))
+	reportPath := "" // Linked from the Slack summary
+	if scraper.Report == "html" {
+		if err := writeHTMLReport(reportFileName, stats, startTime, scraper.CountryDirs); err != nil {
+			slog.Error("Error writing report", "path", reportFileName, "error", err)
+		} else {
+			slog.Info("Report written", "path", reportFileName)
+			reportPath, _ = filepath.Abs(reportFileName)
+		}
+	}
+	scraper.Slack.notifySummary(ctx, stats, startTime, time.Now(), reportPath)
+	return downloadAbort
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"           // Running the scraper
+	"fmt"               // Subtest names
+	"io"                // Parser input and server answers
+	"net/http"          // Mock PDF handler
+	"net/http/httptest" // Built-in mock server
+	"os"                // Output files
+	"path/filepath"     // Output paths
+	"testing"           // Test framework
+)
+
+// testPDF is the body of the PDFs served by newPDFServer.
+const testPDF = "%PDF-1.4\n% test sheet\n%%EOF\n"
+
+// newPDFServer serves testPDF for every path ending in .pdf and 404 otherwise.
+func newPDFServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Ext(r.URL.Path) != ".pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, testPDF)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// mockParser returns canned links for any input and counts its calls.
+type mockParser struct {
+	links []SDSLink
+	calls int
+}
+
+// Parse implements Parser.
+func (parser *mockParser) Parse(r io.Reader, pageURL string) ([]SDSLink, error) {
+	parser.calls++
+	return append([]SDSLink(nil), parser.links...), nil
+}
+
+func TestScraperWithParser(t *testing.T) {
+	server := newPDFServer(t)
+	outputDir := completedScrapeDir(t)
+	parser := &mockParser{links: []SDSLink{
+		{URL: server.URL + "/-/media/sds/first.pdf", Language: "en"},
+		{URL: server.URL + "/-/media/sds/second.pdf", Language: "de"},
+	}}
+	scraper := (&Scraper{CountryDirs: map[string]string{"United States": outputDir}}).WithParser(parser)
+	scraper.Run(context.Background())
+
+	if parser.calls != 1 {
+		t.Errorf("Parse called %d times, want 1", parser.calls)
+	}
+	for _, name := range []string{"first.pdf", "second.pdf"} {
+		content, err := os.ReadFile(filepath.Join(outputDir, "PDFs", name))
+		if err != nil {
+			t.Errorf("PDF of the mock parser not downloaded: %v", err)
+		} else if string(content) != testPDF {
+			t.Errorf("%s = %q, want %q", name, content, testPDF)
+		}
+	}
+	if downloaded := scraper.Stats.PDFsDownloaded.Load(); downloaded != 2 {
+		t.Errorf("PDFsDownloaded = %d, want 2", downloaded)
+	}
+}
+
+func TestScraperMixedCaseURL(t *testing.T) {
+	server := newPDFServer(t)
+	outputDir := completedScrapeDir(t)
+	// The metadata and the manifest entry are looked up by the URL as extracted
+	parser := &mockParser{links: []SDSLink{{URL: server.URL + "/-/media/SDS/Sheet-EN.pdf", Language: "en"}}}
+	scraper := (&Scraper{CountryDirs: map[string]string{"United States": outputDir}}).WithParser(parser)
+	scraper.Run(context.Background())
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "PDFs", "sheet-en.pdf"))
+	if err != nil {
+		t.Fatalf("PDF with a mixed-case URL not downloaded: %v", err)
+	}
+	if string(content) != testPDF {
+		t.Errorf("sheet-en.pdf = %q, want %q", content, testPDF)
+	}
+	if downloaded := scraper.Stats.PDFsDownloaded.Load(); downloaded != 1 {
+		t.Errorf("PDFsDownloaded = %d, want 1", downloaded)
+	}
+}
+
+func TestScraperMixedCaseBaseURL(t *testing.T) {
+	// A mirror that only serves the PDFs under its own, case-sensitive path
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Ecolab/-/media/sds/sheet.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, testPDF)
+	}))
+	t.Cleanup(server.Close)
+	useBaseURL(t, server.URL+"/Ecolab/sds-search")
+	publicURL := "https://www.ecolab.com/-/media/sds/sheet.pdf"
+	if got, want := rebaseURL(publicURL, BaseURL), server.URL+"/Ecolab/-/media/sds/sheet.pdf"; got != want {
+		t.Fatalf("rebaseURL(%q) = %q, want %q", publicURL, got, want)
+	}
+
+	outputDir := completedScrapeDir(t)
+	parser := &mockParser{links: []SDSLink{{URL: publicURL, Language: "en"}}}
+	scraper := (&Scraper{CountryDirs: map[string]string{"United States": outputDir}}).WithParser(parser)
+	scraper.Run(context.Background())
+
+	if content, err := os.ReadFile(filepath.Join(outputDir, "PDFs", "sheet.pdf")); err != nil {
+		t.Errorf("PDF of the mirror not downloaded: %v", err)
+	} else if string(content) != testPDF {
+		t.Errorf("sheet.pdf = %q, want %q", content, testPDF)
+	}
+	if downloaded := scraper.Stats.PDFsDownloaded.Load(); downloaded != 1 {
+		t.Errorf("PDFsDownloaded = %d, want 1", downloaded)
+	}
+}
+
+func TestScraperRunManifestError(t *testing.T) {
+	server := newPDFServer(t)
+	outputDir := completedScrapeDir(t)
+	if err := os.WriteFile(filepath.Join(outputDir, "manifest.json"), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parser := &mockParser{links: []SDSLink{{URL: server.URL + "/-/media/sds/sheet.pdf"}}}
+	scraper := (&Scraper{CountryDirs: map[string]string{"United States": outputDir}}).WithParser(parser)
+	// The error is returned to run instead of exiting the process
+	if err := scraper.Run(context.Background()); err == nil {
+		t.Error("Run with a corrupt manifest succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "PDFs", "sheet.pdf")); err == nil {
+		t.Error("PDF downloaded without a manifest to record it in")
+	}
+}
+
+// completedScrapeDir returns a country directory whose scrape is marked as complete, so
+// Scraper.Run goes straight to the downloads.
+func completedScrapeDir(t *testing.T) string {
+	t.Helper()
+	outputDir := t.TempDir()
+	outputFile := filepath.Join(outputDir, "ecolab-com.html")
+	if err := os.WriteFile(outputFile, []byte("<!DOCTYPE html><html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outputFile+doneFileSuffix, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return outputDir
+}
+
+func TestScraperMaxPDFs(t *testing.T) {
+	server := newPDFServer(t)
+	// A failed download first, which must not count against the limit
+	parser := &mockParser{links: []SDSLink{
+		{URL: server.URL + "/-/media/sds/missing"},
+		{URL: server.URL + "/-/media/sds/a.pdf"},
+		{URL: server.URL + "/-/media/sds/b.pdf"},
+		{URL: server.URL + "/-/media/sds/c.pdf"},
+	}}
+	countryDirs := map[string]string{"United States": completedScrapeDir(t), "Canada": completedScrapeDir(t)}
+	for _, maxPDFs := range []int{1, 2, 3, 5} {
+		t.Run(fmt.Sprint(maxPDFs), func(t *testing.T) {
+			for _, outputDir := range countryDirs {
+				os.RemoveAll(filepath.Join(outputDir, "PDFs"))
+			}
+			scraper := (&Scraper{CountryDirs: countryDirs, MaxPDFs: maxPDFs}).WithParser(parser)
+			scraper.Run(context.Background())
+			// The limit is shared by all countries
+			written := 0
+			for _, outputDir := range countryDirs {
+				files, _ := filepath.Glob(filepath.Join(outputDir, "PDFs", "*"))
+				written += len(files)
+			}
+			if written != maxPDFs {
+				t.Errorf("--max-pdfs %d wrote %d files", maxPDFs, written)
+			}
+			if downloaded := scraper.Stats.PDFsDownloaded.Load(); downloaded != int64(maxPDFs) {
+				t.Errorf("PDFsDownloaded = %d, want %d", downloaded, maxPDFs)
+			}
+		})
+	}
+}
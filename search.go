@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"           // Command line flag parsing
+	"fmt"            // Printing the results
+	"io"             // Results output
+	"log"            // Logging errors
+	"regexp"         // Regular expression queries
+	"strings"        // Substring queries
+	"text/tabwriter" // Aligning the result table
+)
+
+// searchFields maps the --field names (the manifest's JSON keys) to the value of an entry.
+var searchFields = map[string]func(entry ManifestEntry) string{
+	"url":          func(entry ManifestEntry) string { return entry.URL },
+	"language":     func(entry ManifestEntry) string { return entry.Language },
+	"category":     func(entry ManifestEntry) string { return entry.Category },
+	"product_name": func(entry ManifestEntry) string { return entry.ProductName },
+	"cas_number":   func(entry ManifestEntry) string { return entry.CASNumber },
+	"file_path":    func(entry ManifestEntry) string { return entry.FilePath },
+}
+
+// runSearch implements the "search" subcommand: it prints the manifest entries whose
+// fields match the query as a table, without any network access. It returns the
+// process exit code (1 when nothing matched).
+func runSearch(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	manifestPath := flags.String("manifest", "manifest.json", "manifest of the downloaded PDFs")
+	query := flags.String("query", "", "text to search for, case-insensitive (required)")
+	field := flags.String("field", "", "only search this field: url, language, category, product_name, cas_number or file_path (default: all)")
+	useRegex := flags.Bool("regex", false, "treat the query as a regular expression")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+	if *query == "" {
+		log.Println("search: --query is required")
+		flags.Usage()
+		return 2
+	}
+	if *field != "" && searchFields[*field] == nil {
+		log.Printf("search: unknown field %q\n", *field)
+		return 2
+	}
+
+	// Build the matcher: a case-insensitive regular expression or substring
+	var matches func(value string) bool
+	if *useRegex {
+		re, err := regexp.Compile("(?i)" + *query)
+		if err != nil {
+			log.Printf("search: invalid regular expression: %v\n", err)
+			return 2
+		}
+		matches = re.MatchString
+	} else {
+		lowerQuery := strings.ToLower(*query)
+		matches = func(value string) bool { return strings.Contains(strings.ToLower(value), lowerQuery) }
+	}
+	// Load the manifest of the downloaded PDFs
+	manifest, err := loadManifest(*manifestPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	// Print every entry with a matching field
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PRODUCT\tCAS\tLANGUAGE\tCATEGORY\tURL")
+	found := 0
+	for _, entry := range manifest.Entries {
+		matched := false
+		for name, value := range searchFields {
+			if (*field == "" || *field == name) && matches(value(entry)) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", entry.ProductName, entry.CASNumber, entry.Language, entry.Category, entry.URL)
+			found++
+		}
+	}
+	table.Flush()
+	fmt.Fprintf(stdout, "%d of %d entries matched.\n", found, len(manifest.Entries))
+	if found == 0 {
+		return 1
+	}
+	return 0
+}
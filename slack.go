@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"         // Request body
+	"context"       // Request cancellation
+	"encoding/json" // Message encoding
+	"fmt"           // Message formatting
+	"log/slog"      // Logging failed notifications
+	"net/http"      // Posting the message
+	"time"          // Run timestamps
+)
+
+// slackText is a text object of a Block Kit message.
+type slackText struct {
+	Type string `json:"type"` // "plain_text" or "mrkdwn"
+	Text string `json:"text"`
+}
+
+// slackBlock is a header or section block of a Block Kit message.
+type slackBlock struct {
+	Type   string      `json:"type"`             // "header" or "section"
+	Text   *slackText  `json:"text,omitempty"`   // Text of the block
+	Fields []slackText `json:"fields,omitempty"` // Two-column fields of a section
+}
+
+// slackMessage is the body posted to a Slack incoming webhook. Text is shown in
+// notifications, where the blocks are not rendered.
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slackNotifier posts run summaries and alerts to a Slack incoming webhook.
+type slackNotifier struct {
+	URL    string       // Incoming webhook URL
+	Client *http.Client // Client posting the messages (nil = default client)
+}
+
+// slackField renders a bold label above its value.
+func slackField(label, value string) slackText {
+	return slackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", label, value)}
+}
+
+// send posts the message and returns an error for transport failures and non-2xx answers.
+func (notifier *slackNotifier) send(ctx context.Context, message slackMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error encoding Slack message: %w", err)
+	}
+	// Notify even when the run was interrupted, but never wait longer than webhookTimeout
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", notifier.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to Slack: %w", err)
+	}
+	resp.Body.Close() // Slack answers "ok" or an error code, the status is enough
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Slack answered %s", resp.Status)
+	}
+	return nil
+}
+
+// post sends the message and only logs a warning on failure; Slack never aborts the run.
+// A nil notifier does nothing.
+func (notifier *slackNotifier) post(ctx context.Context, message slackMessage) {
+	if notifier == nil {
+		return
+	}
+	if err := notifier.send(ctx, message); err != nil {
+		slog.Warn("Slack notification failed", "error", err)
+	}
+}
+
+// notifySummary posts the summary of a finished run; reportPath is the HTML report
+// written by the run ("" = none).
+func (notifier *slackNotifier) notifySummary(ctx context.Context, stats *Statistics, started, finished time.Time, reportPath string) {
+	title := "Ecolab SDS scrape finished"
+	if ctx.Err() != nil {
+		title = "Ecolab SDS scrape interrupted"
+	}
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+		{Type: "section", Fields: []slackText{
+			slackField("Started", started.Format(time.RFC1123)),
+			slackField("Finished", finished.Format(time.RFC1123)),
+			slackField("Pages scraped", fmt.Sprint(stats.PagesScraped.Load())),
+			slackField("PDFs downloaded", fmt.Sprintf("%d (%s)", stats.PDFsDownloaded.Load(), formatBytes(stats.BytesDownloaded.Load()))),
+			slackField("Errors", fmt.Sprint(stats.Errors.Load())),
+			slackField("Skipped", fmt.Sprint(stats.Skipped.Load())),
+		}},
+	}
+	if reportPath != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("<file://%s|HTML report> (`%s`)", reportPath, reportPath)}})
+	}
+	notifier.post(ctx, slackMessage{Text: fmt.Sprintf("%s: %s", title, stats.summary(finished.Sub(started))), Blocks: blocks})
+}
+
+// notifyAlert posts an alert about a run that is failing, with the number of errors so
+// far and the last page scraped successfully.
+func (notifier *slackNotifier) notifyAlert(ctx context.Context, stats *Statistics, reason string) {
+	lastPage := "none"
+	if page := stats.LastPageScraped.Load(); page > 0 {
+		lastPage = fmt.Sprint(page)
+	}
+	title := "Ecolab SDS scrape failing"
+	notifier.post(ctx, slackMessage{
+		Text: fmt.Sprintf("%s: %d errors, last page scraped %s", title, stats.Errors.Load(), lastPage),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: reason}},
+			{Type: "section", Fields: []slackText{
+				slackField("Errors", fmt.Sprint(stats.Errors.Load())),
+				slackField("Last page scraped", lastPage),
+			}},
+		},
+	})
+}
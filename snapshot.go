@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"           // Formatting for error messages
+	"io"            // Output of the page copies
+	"os"            // File operations
+	"path/filepath" // Path manipulation
+	"slices"        // Sorting the offsets
+	"strconv"       // Parsing the offsets from the file names
+	"strings"       // File name suffix handling
+)
+
+// snapshotPageSuffix ends the name of every page copy in the pages directory.
+const snapshotPageSuffix = ".html"
+
+// writePageSnapshot stores a copy of every scraped page in pagesDir, named after its
+// offset, replacing the copy of an earlier run. Pages that were not fetched again keep
+// their earlier copy.
+func writePageSnapshot(pagesDir string, pages map[int]string) error {
+	if err := ensureDir(0755, pagesDir); err != nil {
+		return err
+	}
+	for offset, pageHTML := range pages {
+		pagePath := filepath.Join(pagesDir, strconv.Itoa(offset)+snapshotPageSuffix)
+		if err := os.WriteFile(pagePath, []byte(pageHTML), 0644); err != nil {
+			return fmt.Errorf("error saving page copy %s: %w", pagePath, err)
+		}
+	}
+	return nil
+}
+
+// writeSnapshotPages writes the page copies of pagesDir to w in ascending offset order,
+// so the output holds the current state of the site instead of every page ever scraped.
+func writeSnapshotPages(w io.Writer, pagesDir string, compress bool) error {
+	entries, err := os.ReadDir(pagesDir)
+	if err != nil {
+		return fmt.Errorf("error reading page copies in %s: %w", pagesDir, err)
+	}
+	// Collect the offsets of the page copies, ignoring any other file
+	var offsets []int
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), snapshotPageSuffix)
+		if offset, err := strconv.Atoi(name); found && err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	slices.Sort(offsets)
+	for _, offset := range offsets {
+		pageHTML, err := os.ReadFile(filepath.Join(pagesDir, strconv.Itoa(offset)+snapshotPageSuffix))
+		if err != nil {
+			return fmt.Errorf("error reading page copy: %w", err)
+		}
+		if err := writePage(w, pageHTML, compress); err != nil {
+			return fmt.Errorf("error writing page copy %d: %w", offset, err)
+		}
+	}
+	return nil
+}
+
+// prunePageSnapshot removes the page copies of pagesDir starting at offset total or later,
+// so a snapshot does not keep listing the documents of pages the site no longer has, and
+// forgets their validators, so they are fetched in full should they come back. It returns
+// the number of copies removed.
+func prunePageSnapshot(pagesDir string, total int) (int, error) {
+	entries, err := os.ReadDir(pagesDir)
+	if os.IsNotExist(err) {
+		return 0, nil // No copies yet
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading page copies in %s: %w", pagesDir, err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), snapshotPageSuffix)
+		if offset, err := strconv.Atoi(name); found && err == nil && offset >= total {
+			if err := os.Remove(filepath.Join(pagesDir, entry.Name())); err != nil {
+				return removed, fmt.Errorf("error removing page copy: %w", err)
+			}
+			removed++
+		}
+	}
+	cachePath := filepath.Join(pagesDir, ".etags.json")
+	if cache := loadPageCache(cachePath); cache.forgetFrom(total) > 0 {
+		if err := cache.save(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"      // Cancellation of the statements
+	"database/sql" // SQL database access
+	"fmt"          // Error formatting
+	"time"         // Row timestamps
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, no CGO needed
+)
+
+// Download status of a link in the SQLite output.
+const (
+	sqliteStatusPending    = "pending"    // Extracted, not downloaded yet (e.g. limited by --max-pdfs)
+	sqliteStatusDownloaded = "downloaded" // The PDF is on disk
+	sqliteStatusSkipped    = "skipped"    // Deliberately not downloaded, e.g. too large or not a PDF
+	sqliteStatusFailed     = "failed"     // The download failed, see the error column
+)
+
+// sqliteSchema creates the links table and its indices when they do not exist yet.
+// A URL can be listed for several countries, so rows are unique per country and URL.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sds_links (
+	country         TEXT NOT NULL,
+	url             TEXT NOT NULL,
+	language        TEXT NOT NULL DEFAULT '',
+	language_source TEXT NOT NULL DEFAULT '',
+	category        TEXT NOT NULL DEFAULT '',
+	product_name    TEXT NOT NULL DEFAULT '',
+	cas_number      TEXT NOT NULL DEFAULT '',
+	revision_date   TEXT NOT NULL DEFAULT '',
+	file_path       TEXT NOT NULL DEFAULT '',
+	status          TEXT NOT NULL,
+	error           TEXT NOT NULL DEFAULT '',
+	sha256          TEXT NOT NULL DEFAULT '',
+	size            INTEGER NOT NULL DEFAULT 0,
+	updated_at      TEXT NOT NULL,
+	PRIMARY KEY (country, url)
+);
+CREATE INDEX IF NOT EXISTS sds_links_url ON sds_links (url);
+CREATE INDEX IF NOT EXISTS sds_links_cas_number ON sds_links (cas_number);
+CREATE INDEX IF NOT EXISTS sds_links_revision_date ON sds_links (revision_date);
+`
+
+// sqliteOutput writes the extracted links and their download status to a SQLite database.
+type sqliteOutput struct {
+	db *sql.DB // Database opened by openSQLiteOutput
+}
+
+// openSQLiteOutput opens (or creates) the database at path and creates the schema.
+func openSQLiteOutput(path string) (*sqliteOutput, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening SQLite database %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1) // SQLite allows a single writer, serialize instead of failing with SQLITE_BUSY
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema in %s: %w", path, err)
+	}
+	return &sqliteOutput{db: db}, nil
+}
+
+// Close closes the database. A nil output does nothing.
+func (output *sqliteOutput) Close() error {
+	if output == nil {
+		return nil
+	}
+	return output.db.Close()
+}
+
+// recordLinks inserts the links of a country as pending, or refreshes the metadata of links
+// recorded by a previous run without touching their download status.
+func (output *sqliteOutput) recordLinks(ctx context.Context, country string, links []SDSLink) error {
+	transaction, err := output.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting SQLite transaction: %w", err)
+	}
+	defer transaction.Rollback() // No-op after a successful commit
+	statement, err := transaction.PrepareContext(ctx, `
+		INSERT INTO sds_links (country, url, language, language_source, category, product_name, cas_number, revision_date, status, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (country, url) DO UPDATE SET
+			language = excluded.language, language_source = excluded.language_source, category = excluded.category,
+			product_name = excluded.product_name, cas_number = excluded.cas_number, revision_date = excluded.revision_date,
+			updated_at = excluded.updated_at`)
+	if err != nil {
+		return fmt.Errorf("error preparing SQLite insert: %w", err)
+	}
+	defer statement.Close()
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, link := range links {
+		if _, err := statement.ExecContext(ctx, country, link.URL, link.Language, link.LanguageSource, link.Category,
+			link.ProductName, link.CASNumber, link.RevisionDate, sqliteStatusPending, now); err != nil {
+			return fmt.Errorf("error recording link %s: %w", link.URL, err)
+		}
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error committing SQLite transaction: %w", err)
+	}
+	return nil
+}
+
+// recordDownload stores the outcome of the download of a link recorded by recordLinks.
+// The file columns are only updated from entry for downloaded PDFs, so a failed retry
+// keeps the details of the copy downloaded before; downloadErr explains the other statuses.
+func (output *sqliteOutput) recordDownload(ctx context.Context, country, url, status string, entry ManifestEntry, downloadErr error) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var err error
+	if status == sqliteStatusDownloaded {
+		_, err = output.db.ExecContext(ctx, `
+			UPDATE sds_links SET status = ?, error = '', file_path = ?, sha256 = ?, size = ?, updated_at = ?
+			WHERE country = ? AND url = ?`,
+			status, entry.FilePath, entry.Checksum.sha256(), entry.Size, now, country, url)
+	} else {
+		errorText := ""
+		if downloadErr != nil {
+			errorText = downloadErr.Error()
+		}
+		_, err = output.db.ExecContext(ctx, `
+			UPDATE sds_links SET status = ?, error = ?, updated_at = ?
+			WHERE country = ? AND url = ?`,
+			status, errorText, now, country, url)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording download of %s: %w", url, err)
+	}
+	return nil
+}
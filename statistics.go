@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"         // Formatting of the summary
+	"sync/atomic" // Lock-free counters
+	"time"        // Run duration
+)
+
+// Statistics counts the work done during a run. All fields are safe for concurrent use.
+type Statistics struct {
+	PagesScraped    atomic.Int64 // Search result pages fetched and saved
+	PDFsDownloaded  atomic.Int64 // PDFs written to disk
+	BytesDownloaded atomic.Int64 // Total size of the PDFs written to disk
+	Errors          atomic.Int64 // Failed page fetches and PDF downloads
+	Skipped         atomic.Int64 // Pages and PDFs skipped (unchanged, disallowed, aborted or already downloaded)
+	DownloadErrors  atomic.Int64 // Failed PDF downloads (also counted in Errors)
+	PDFsTotal       atomic.Int64 // PDF links selected for download
+	LastScrapeUnix  atomic.Int64 // Unix time at which the last scrape phase finished
+	ScrapeDuration  atomic.Int64 // Duration of the last scrape phase, as a time.Duration
+	LastPageScraped atomic.Int64 // Number of the search result page scraped most recently (0 = none)
+	Requests        atomic.Int64 // HTTP requests sent by the page and PDF clients, see withConnectionCounting
+	NewConnections  atomic.Int64 // TCP connections dialed by the page and PDF clients
+	phase           atomic.Value // Phase of the pipeline, see setPhase
+}
+
+// Phases of the pipeline reported by the health endpoint.
+const (
+	phaseIdle     = "idle"     // No run in progress, e.g. between scheduled runs
+	phaseScrape   = "scrape"   // Fetching the search result pages
+	phaseDownload = "download" // Downloading the PDFs
+)
+
+// setPhase records the phase the pipeline entered.
+func (stats *Statistics) setPhase(phase string) {
+	stats.phase.Store(phase)
+}
+
+// currentPhase returns the phase of the pipeline, phaseIdle before the first run.
+func (stats *Statistics) currentPhase() string {
+	if phase, ok := stats.phase.Load().(string); ok {
+		return phase
+	}
+	return phaseIdle
+}
+
+// errorRate returns the share of page fetches and PDF downloads of the run that failed
+// (0 before anything was attempted).
+func (stats *Statistics) errorRate() float64 {
+	failed := stats.Errors.Load()
+	attempts := stats.PagesScraped.Load() + stats.PDFsDownloaded.Load() + failed
+	if attempts == 0 {
+		return 0
+	}
+	return float64(failed) / float64(attempts)
+}
+
+// reset clears the counters at the start of a run. The timestamp and duration
+// of the last scrape phase are kept until the new scrape phase finishes.
+func (stats *Statistics) reset() {
+	stats.PagesScraped.Store(0)
+	stats.PDFsDownloaded.Store(0)
+	stats.BytesDownloaded.Store(0)
+	stats.Errors.Store(0)
+	stats.Skipped.Store(0)
+	stats.DownloadErrors.Store(0)
+	stats.PDFsTotal.Store(0)
+	stats.LastPageScraped.Store(0)
+	stats.Requests.Store(0)
+	stats.NewConnections.Store(0)
+}
+
+// summary renders the counters as a human readable line, e.g.
+// "Scraped 1270 pages, downloaded 11834 PDFs (5.7 GB) in 23m14s; 12 skipped, 3 errors".
+func (stats *Statistics) summary(elapsed time.Duration) string {
+	return fmt.Sprintf("Scraped %d pages, downloaded %d PDFs (%s) in %s; %d skipped, %d errors",
+		stats.PagesScraped.Load(), stats.PDFsDownloaded.Load(), formatBytes(stats.BytesDownloaded.Load()),
+		elapsed.Round(time.Second), stats.Skipped.Load(), stats.Errors.Load())
+}
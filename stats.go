@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the report
+	"io"            // Report output
+	"io/fs"         // Directory walking
+	"log"           // Logging errors
+	"path/filepath" // Path manipulation
+	"sort"          // Sorting the breakdown rows
+	"strings"       // String manipulation
+)
+
+// runStats implements the "stats" subcommand: it reports how many SDS sheets are known,
+// downloaded and pending, the disk usage of the PDFs folder and a breakdown of the
+// downloaded sheets by language and category. It returns the process exit code.
+func runStats(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	outputDir := flags.String("dir", ".", "output directory holding manifest.json, ecolab-com-links.txt and PDFs/")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+
+	// Load the manifest of the downloaded PDFs
+	manifest, err := loadManifest(filepath.Join(*outputDir, "manifest.json"))
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	// Every link ever found is known, whether or not it was downloaded
+	known := make(map[string]bool)
+	for _, link := range splitLines(readAFileAsString(filepath.Join(*outputDir, "ecolab-com-links.txt"))) {
+		known[link] = true
+	}
+	// Count the manifest entries whose file is still on disk
+	downloaded := 0
+	byLanguage := make(map[string]int)
+	byCategory := make(map[string]int)
+	for _, entry := range manifest.Entries {
+		known[entry.URL] = true
+		if !fileExists(entry.FilePath) {
+			continue // Recorded but deleted since
+		}
+		downloaded++
+		byLanguage[entry.Language]++
+		byCategory[entry.Category]++
+	}
+	// Add up the size of everything in the PDFs folder
+	var diskUsage int64
+	fileCount := 0
+	filepath.WalkDir(filepath.Join(*outputDir, "PDFs"), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && entry.Name() == trashDirName {
+			return filepath.SkipDir // Purged files no longer count as downloaded
+		}
+		if err != nil || entry.IsDir() {
+			return nil // Skip unreadable entries and directories
+		}
+		if info, err := entry.Info(); err == nil {
+			diskUsage += info.Size()
+			fileCount++
+		}
+		return nil
+	})
+
+	fmt.Fprintf(stdout, "Known SDS sheets:   %d\n", len(known))
+	fmt.Fprintf(stdout, "Downloaded PDFs:    %d\n", downloaded)
+	fmt.Fprintf(stdout, "Pending downloads:  %d\n", len(known)-downloaded)
+	fmt.Fprintf(stdout, "Disk usage:         %s in %d files\n", formatBytes(diskUsage), fileCount)
+	printBreakdown(stdout, "language", byLanguage)
+	printBreakdown(stdout, "category", byCategory)
+	return 0
+}
+
+// printBreakdown prints the counts of a breakdown to w, largest first. Breakdowns
+// where no entry has a value for the field are omitted.
+func printBreakdown(w io.Writer, field string, counts map[string]int) {
+	if len(counts) == 0 || (len(counts) == 1 && counts[""] > 0) {
+		return // The manifest has no values for this field
+	}
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	fmt.Fprintf(w, "\nBy %s:\n", field)
+	for _, value := range values {
+		label := value
+		if label == "" {
+			label = "(unknown)"
+		}
+		fmt.Fprintf(w, "  %-30s %d\n", label, counts[value])
+	}
+}
+
+// splitLines returns the trimmed, non-empty lines of text.
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "5.7 GB".
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	divisor, exponent := int64(unit), 0
+	for remaining := size / unit; remaining >= unit; remaining /= unit {
+		divisor *= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(divisor), "KMGTPE"[exponent])
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"         // Peeking at the gzip magic bytes
+	"bytes"         // Magic bytes comparison
+	"compress/gzip" // Compressed scrape output
+	"encoding/json" // Embedded JSON scripts
+	"errors"        // Missing results count
+	"fmt"           // Error formatting
+	"io"            // Streaming input
+	"log"           // Logging parse errors
+	"os"            // Opening the scrape output
+	"regexp"        // Results count
+	"slices"        // Class list matching
+	"strconv"       // Parsing the results count
+	"strings"       // Text and attribute handling
+
+	"golang.org/x/net/html"      // HTML tokenizer
+	"golang.org/x/net/html/atom" // HTML element names
+)
+
+// voidElements never have an end tag, so they are not pushed on the element stack.
+var voidElements = []atom.Atom{atom.Area, atom.Base, atom.Br, atom.Col, atom.Embed, atom.Hr, atom.Img,
+	atom.Input, atom.Link, atom.Meta, atom.Source, atom.Track, atom.Wbr}
+
+// openCard is an SDS result card whose end tag has not been read yet.
+type openCard struct {
+	sdsCard
+	depth int // Depth of the card element on the element stack
+}
+
+// openField is a card field whose text is being collected.
+type openField struct {
+	card  *openCard       // Card the field belongs to
+	name  string          // Field name, e.g. "product-name"
+	depth int             // Depth of the field element on the element stack
+	text  strings.Builder // Text read so far
+}
+
+// pageExtractor collects the links of one page from its elements and text, fed in
+// document order. It is the card state machine shared by both parsers: the tokenizer of
+// extractLinksFromReader and the node walk of extractPageLinks. Only the open cards,
+// fields and scripts are held in memory.
+type pageExtractor struct {
+	offset       int          // Byte offset of the page in the input
+	language     string       // Language of the <html lang> attribute
+	url          string       // URL of the <link rel="canonical"> of the page
+	links        []SDSLink    // Links found so far
+	scripts      []string     // Embedded JSON scripts, decoded if the page has no PDF anchors
+	stack        []string     // Names of the open elements
+	cards        []*openCard  // Open result cards, the innermost last
+	fields       []*openField // Open card fields, the innermost last
+	inJSONScript bool         // The next text is the content of an embedded JSON script
+}
+
+// newPageExtractor starts the page found at the byte offset of the input.
+func newPageExtractor(offset int) *pageExtractor {
+	return &pageExtractor{offset: offset}
+}
+
+// startElement reads a start tag. Elements without content (void or self-closing ones)
+// get no end tag, so they are not pushed on the element stack.
+func (page *pageExtractor) startElement(dataAtom atom.Atom, name string, attributes []html.Attribute, hasContent bool) {
+	page.inJSONScript = dataAtom == atom.Script && hasContent && isJSONScript(attributes)
+	// The language of the whole page
+	if dataAtom == atom.Html && page.language == "" {
+		pageLanguage, _, _ := strings.Cut(attributeOf(attributes, "lang"), "-") // e.g. "en-US" -> "en"
+		page.language = normalizeLanguage(pageLanguage)
+	}
+	// The URL of the page, sent as the Referer of its PDFs
+	if dataAtom == atom.Link && page.url == "" && isCanonicalLink(attributeOf(attributes, "rel")) {
+		page.url = strings.TrimSpace(attributeOf(attributes, "href"))
+	}
+	// A PDF download anchor
+	if dataAtom == atom.A {
+		if href := strings.TrimSpace(attributeOf(attributes, "href")); isPDFURL(href) {
+			pdfURL := strings.ToLower(href) // Lowercase the link for consistency with the links file
+			if len(page.cards) > 0 {
+				card := page.cards[len(page.cards)-1]
+				card.urls = append(card.urls, pdfURL)
+			} else {
+				page.links = append(page.links, SDSLink{URL: pdfURL})
+			}
+		}
+	}
+	if !hasContent || slices.Contains(voidElements, dataAtom) {
+		return // No content, nothing to collect
+	}
+	page.stack = append(page.stack, name)
+	depth := len(page.stack)
+	// A result card, or a metadata field of the enclosing card
+	if listsClass(attributes, "sds-result") {
+		page.cards = append(page.cards, &openCard{sdsCard: sdsCard{fields: make(map[string]string)}, depth: depth})
+	} else if len(page.cards) > 0 {
+		card := page.cards[len(page.cards)-1]
+		for _, field := range sdsCardFields {
+			if card.fields[field] == "" && listsClass(attributes, "sds-"+field) {
+				page.fields = append(page.fields, &openField{card: card, name: field, depth: depth})
+			}
+		}
+	}
+}
+
+// wantsText reports whether text read now would be collected, so the tokenizer only
+// copies the text it needs.
+func (page *pageExtractor) wantsText() bool {
+	return page.inJSONScript || len(page.fields) > 0
+}
+
+// text reads the text between tags.
+func (page *pageExtractor) text(data []byte) {
+	if page.inJSONScript {
+		page.scripts = append(page.scripts, string(data))
+	}
+	for _, field := range page.fields {
+		field.text.Write(data)
+	}
+}
+
+// endElement reads an end tag: it closes the innermost open element with this name and
+// everything opened inside it. End tags without an open element are ignored.
+func (page *pageExtractor) endElement(name string) {
+	page.inJSONScript = false
+	for depth := len(page.stack); depth > 0; depth-- {
+		if page.stack[depth-1] == name {
+			page.closeElements(depth - 1)
+			return
+		}
+	}
+}
+
+// closeElements pops the elements above depth, finishing the cards and fields they close.
+func (page *pageExtractor) closeElements(depth int) {
+	page.stack = page.stack[:depth]
+	for len(page.fields) > 0 && page.fields[len(page.fields)-1].depth > depth {
+		field := page.fields[len(page.fields)-1]
+		field.card.fields[field.name] = strings.TrimSpace(field.text.String())
+		page.fields = page.fields[:len(page.fields)-1]
+	}
+	for len(page.cards) > 0 && page.cards[len(page.cards)-1].depth > depth {
+		card := page.cards[len(page.cards)-1]
+		for _, pdfURL := range card.urls {
+			page.links = append(page.links, SDSLink{
+				URL:          pdfURL,
+				Language:     normalizeLanguage(card.fields["language"]),
+				Category:     card.fields["category"],
+				ProductName:  card.fields["product-name"],
+				CASNumber:    card.fields["cas-number"],
+				RevisionDate: card.fields["revision-date"],
+			})
+		}
+		page.cards = page.cards[:len(page.cards)-1]
+	}
+}
+
+// finish closes the elements left open and returns the links of the page. Pages without
+// PDF anchors fall back to the JSON data embedded for client side rendering; a script
+// that cannot be decoded is reported as a *ParseError, together with the links that could
+// still be extracted. Links without a card language get the language of the page.
+func (page *pageExtractor) finish() ([]SDSLink, error) {
+	page.closeElements(0)
+	var parseErr error
+	if len(page.links) == 0 {
+		for _, script := range page.scripts {
+			var data any
+			if err := json.Unmarshal([]byte(script), &data); err != nil {
+				parseErr = &ParseError{Offset: page.offset, Err: fmt.Errorf("failed to decode embedded JSON: %w", err)}
+				break
+			}
+			page.links = append(page.links, collectJSONLinks(data)...)
+		}
+	}
+	// Tell the languages of the cards apart from the language of the page
+	for index := range page.links {
+		page.links[index].SourceURL = page.url
+		if page.links[index].Language != "" {
+			page.links[index].LanguageSource = "card"
+		} else if page.language != "" {
+			page.links[index].Language = page.language
+			page.links[index].LanguageSource = "page"
+		}
+	}
+	return page.links, parseErr
+}
+
+// listsClass reports whether the class attribute among attributes lists class.
+func listsClass(attributes []html.Attribute, class string) bool {
+	for _, attribute := range attributes {
+		if attribute.Key == "class" && slices.Contains(strings.Fields(attribute.Val), class) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeOf returns the value of the named attribute ("" if absent).
+func attributeOf(attributes []html.Attribute, name string) string {
+	for _, attribute := range attributes {
+		if attribute.Key == name {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+// isCanonicalLink reports whether the rel attribute of a <link> tag names the canonical URL of the page.
+func isCanonicalLink(rel string) bool {
+	return slices.Contains(strings.Fields(strings.ToLower(rel)), "canonical")
+}
+
+// isJSONScript reports whether a <script> start tag with these attributes embeds JSON
+// data: the __NEXT_DATA__ of client side rendered pages or an application/json or
+// application/ld+json script.
+func isJSONScript(attributes []html.Attribute) bool {
+	scriptType := strings.ToLower(attributeOf(attributes, "type"))
+	return attributeOf(attributes, "id") == "__NEXT_DATA__" || scriptType == "application/json" || scriptType == "application/ld+json"
+}
+
+// extractLinksFromReader extracts the PDF links of the concatenated pages read from r
+// with an html.Tokenizer feeding a pageExtractor: only the current cards, fields and
+// scripts are held in memory, never the whole input. Each doctype starts a new page.
+// Parse errors are logged with the byte offset of their page; the links that could
+// still be extracted are returned together with a read error, if any.
+func extractLinksFromReader(r io.Reader) ([]SDSLink, error) {
+	tokenizer := html.NewTokenizer(r)
+	var links []SDSLink
+	offset := 0 // Bytes consumed by the tokenizer so far
+	page := newPageExtractor(offset)
+	// endPage flushes the links of the current page and starts the next one
+	endPage := func() {
+		pageLinks, err := page.finish()
+		if err != nil {
+			log.Println(err)
+		}
+		links = append(links, pageLinks...)
+		page = newPageExtractor(offset)
+	}
+	for {
+		tokenType := tokenizer.Next()
+		rawLength := len(tokenizer.Raw())
+		switch tokenType {
+		case html.ErrorToken:
+			endPage()
+			if err := tokenizer.Err(); err != io.EOF {
+				return links, fmt.Errorf("error reading HTML: %w", err)
+			}
+			return links, nil
+		case html.DoctypeToken:
+			// A new page of the scrape output starts
+			if offset > 0 {
+				endPage()
+			}
+		case html.TextToken:
+			if page.wantsText() {
+				page.text(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			page.startElement(token.DataAtom, token.Data, token.Attr, tokenType == html.StartTagToken)
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			page.endElement(string(name))
+		}
+		offset += rawLength
+	}
+}
+
+// extractDownloadLinksFromFile streams the links out of a scrape output file with parser
+// (nil = TokenizerParser), decompressing files written with --compress, and cleans them
+// with cleanExtractedLinks, removing the query parameters matching stripParams.
+func extractDownloadLinksFromFile(path string, parser Parser, stripParams []string) ([]SDSLink, error) {
+	if parser == nil {
+		parser = TokenizerParser{}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// Files written with --compress start with the gzip magic bytes
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	if magic, _ := reader.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing %s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+	// Transcode pages declared as latin-1, windows-1252, ... so product names keep their accents
+	buffered := bufio.NewReader(input)
+	input = buffered
+	head, _ := buffered.Peek(charsetSniffLength) // Shorter files return what they have
+	decoder, err := charsetDecoder(detectCharset(head))
+	if err != nil {
+		log.Printf("Reading %s as UTF-8: %v\n", path, err) // Garbled accents are better than no links
+	} else if decoder != nil {
+		input = decoder.Reader(buffered)
+	}
+	links, err := parser.Parse(input, "")
+	if err != nil {
+		err = fmt.Errorf("error extracting links from %s: %w", path, err)
+	}
+	return cleanExtractedLinks(links, stripParams), err
+}
+
+// countSDSResults counts the SDS result cards (class "sds-result") of a single page.
+func countSDSResults(pageHTML string) int {
+	tokenizer := html.NewTokenizer(strings.NewReader(pageHTML))
+	count := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return count
+		case html.StartTagToken:
+			if listsClass(tokenizer.Token().Attr, "sds-result") {
+				count++
+			}
+		}
+	}
+}
+
+// sdsCountPattern matches the total of the results count line, e.g. "Showing 1-10 of 12,700 results".
+var sdsCountPattern = regexp.MustCompile(`of\s+([\d,.]+)\s+results`)
+
+// parseSDSCount returns the number of SDS sheets listed by the search, read from the
+// results count (class "sds-results-count") of a search result page.
+func parseSDSCount(pageHTML string) (int, error) {
+	tokenizer := html.NewTokenizer(strings.NewReader(pageHTML))
+	inCount := false // Inside the results count element
+	var text strings.Builder
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return 0, errors.New("no results count on the page")
+		case html.StartTagToken:
+			if listsClass(tokenizer.Token().Attr, "sds-results-count") {
+				inCount = true
+			}
+		case html.TextToken:
+			if inCount {
+				text.Write(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			if !inCount {
+				continue
+			}
+			match := sdsCountPattern.FindStringSubmatch(text.String())
+			if match == nil {
+				return 0, fmt.Errorf("invalid results count %q", strings.TrimSpace(text.String()))
+			}
+			count, err := strconv.Atoi(strings.NewReplacer(",", "", ".", "").Replace(match[1]))
+			if err != nil || count == 0 {
+				return 0, fmt.Errorf("invalid results count %q", strings.TrimSpace(text.String()))
+			}
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"    // Peeking at the PDF header
+	"bytes"    // Header comparison
+	"context"  // Request cancellation
+	"fmt"      // Error formatting
+	"io"       // Streaming the body
+	"log/slog" // Logging skipped PDFs
+	"net/http" // Downloading the PDF
+	"path"     // Object key of the PDF
+	"time"     // Download duration
+)
+
+// maxBytesReader fails with errFileTooLarge once more than remaining bytes are read,
+// which aborts a streamed upload of a PDF whose size was not announced.
+type maxBytesReader struct {
+	reader    io.Reader // Body being streamed
+	remaining int64     // Bytes still allowed
+}
+
+func (limited *maxBytesReader) Read(buffer []byte) (int, error) {
+	read, err := limited.reader.Read(buffer)
+	limited.remaining -= int64(read)
+	if limited.remaining < 0 {
+		return read, errFileTooLarge
+	}
+	return read, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader // Underlying reader
+	count  int64     // Bytes read so far
+}
+
+func (counting *countingReader) Read(buffer []byte) (int, error) {
+	read, err := counting.reader.Read(buffer)
+	counting.count += int64(read)
+	return read, err
+}
+
+// streamPDFToS3 pipes the download of a PDF straight into an S3 (multipart) upload,
+// without writing it to disk, for --stream-to-s3. The object key is the one upload would
+// use for the local path in folder. The checksum and size are computed while streaming,
+// and the returned manifest entry records the object key but no local path. A PDF
+// already uploaded according to expected is only streamed again when the server reports
+// a change of its validators. Like downloadPDF, resources that are not PDFs are skipped
+// with errNotPDF and PDFs larger than opts.MaxFileSize with errFileTooLarge; bodies
+// without a %PDF- header or smaller than opts.MinFileSize are never uploaded.
+func streamPDFToS3(ctx context.Context, opts DownloadOptions, link SDSLink, folder string, expected *ManifestEntry) (entry ManifestEntry, err error) {
+	stats := opts.Stats // Counters of the current run
+	// Count every failed download; PDFs skipped on purpose are counted as skipped
+	defer func() {
+		if isSkippedDownload(err) {
+			stats.Skipped.Add(1)
+		} else if err != nil {
+			stats.Errors.Add(1)
+			stats.DownloadErrors.Add(1)
+		}
+		// Let callers tell download failures apart with errors.As
+		if err != nil {
+			err = &DownloadError{PDFURL: link.URL, Err: err}
+		}
+	}()
+
+	fileName, err := getFileNamesFromURLs(link.URL) // Get file name from the URL
+	if err != nil {
+		return entry, err // Nothing sensible to name the object after
+	}
+	key := opts.S3.keyFor(path.Join(folder, fileName))
+	// An uploaded PDF is only streamed again when it changed
+	uploaded := expected != nil && expected.S3Key == key
+	if uploaded && expected.pageValidators == (pageValidators{}) {
+		slog.Info("PDF already uploaded, skipping download", "key", key)
+		stats.Skipped.Add(1)
+		return *expected, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", link.URL, nil) // Create the GET request for the PDF
+	if err != nil {
+		return entry, fmt.Errorf("error creating request for %s: %w", link.URL, err)
+	}
+	req.Header.Set("Referer", link.referer()) // Like a click on the search page
+	if uploaded {                             // Only send the PDF again if it changed
+		expected.applyTo(req)
+	}
+	startTime := time.Now()          // Measure the download duration
+	resp, err := opts.Client.Do(req) // Send GET request to download PDF
+	if err != nil {
+		return entry, fmt.Errorf("error downloading PDF: %w", asRedirectLoopError(link.URL, err))
+	}
+	defer resp.Body.Close() // Ensure response body is closed
+	if uploaded && resp.StatusCode == http.StatusNotModified {
+		slog.Info("PDF not modified, skipping download", "key", key)
+		stats.Skipped.Add(1)
+		return *expected, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return entry, fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+	meta := pdfMetadata{pageValidators: validatorsFromHeader(resp.Header), ContentType: resp.Header.Get("Content-Type")}
+	if resp.ContentLength > 0 {
+		meta.ContentLength = resp.ContentLength
+	}
+	// Skip resources that are not PDFs and PDFs larger than the limit
+	if !isPDFContentType(meta.ContentType) {
+		return entry, fmt.Errorf("%w: %s has Content-Type %s", errNotPDF, link.URL, meta.ContentType)
+	}
+	if opts.MaxFileSize > 0 && resp.ContentLength > opts.MaxFileSize {
+		return entry, fmt.Errorf("%w: %s has %d bytes, the limit is %d", errFileTooLarge, link.URL, resp.ContentLength, opts.MaxFileSize)
+	}
+
+	// Check the start of the body before anything is uploaded, nothing can be deleted afterwards
+	reader := bufio.NewReaderSize(resp.Body, max(pdfHeaderWindow, int(opts.MinFileSize)))
+	head, err := reader.Peek(max(pdfHeaderWindow, int(opts.MinFileSize)))
+	if err != nil && err != io.EOF {
+		return entry, fmt.Errorf("error downloading PDF: %w", err)
+	}
+	if !bytes.Contains(head[:min(len(head), pdfHeaderWindow)], []byte("%PDF-")) {
+		return entry, fmt.Errorf("%w: %s: no %%PDF- header", errInvalidPDF, link.URL)
+	}
+	if opts.MinFileSize > 0 && int64(len(head)) < opts.MinFileSize {
+		return entry, fmt.Errorf("%w: %s has only %d bytes, less than %d", errInvalidPDF, link.URL, len(head), opts.MinFileSize)
+	}
+	// Hash the body on its way to S3
+	hasher, err := newChecksumHash(opts.ChecksumAlgo)
+	if err != nil {
+		return entry, err
+	}
+	counter := &countingReader{reader: io.TeeReader(reader, hasher)}
+	var body io.Reader = counter
+	limited := &maxBytesReader{reader: counter, remaining: opts.MaxFileSize}
+	if opts.MaxFileSize > 0 {
+		body = limited
+	}
+	if err := opts.S3.uploadStream(ctx, key, body); err != nil {
+		// The SDK wraps the reader's error, so ask the reader whether it stopped the upload
+		if opts.MaxFileSize > 0 && limited.remaining < 0 {
+			return entry, fmt.Errorf("%w: %s has more than %d bytes", errFileTooLarge, link.URL, opts.MaxFileSize)
+		}
+		return entry, err
+	}
+	resp.Body.Close() // The upload read the whole body
+	downloadDuration := time.Since(startTime)
+	meta.DownloadDurationMS = downloadDuration.Milliseconds()
+	opts.checkSlowDownload(link.URL, downloadDuration)
+
+	stats.PDFsDownloaded.Add(1)              // Count the completed download
+	stats.BytesDownloaded.Add(counter.count) // Count the bytes transferred by this request
+	opts.logger().Info("pdf streamed to s3", "key", key, "url", link.URL, "bytes", counter.count, "duration_ms", meta.DownloadDurationMS)
+	return ManifestEntry{
+		SDSLink:     link,
+		Checksum:    checksumOf(opts.ChecksumAlgo, hasher),
+		Size:        counter.count,
+		S3Key:       key,
+		pdfMetadata: meta,
+	}, nil
+}
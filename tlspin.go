@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"         // Fingerprint comparison
+	"crypto/sha256" // Certificate fingerprints
+	"crypto/tls"    // Peer certificate verification
+	"crypto/x509"   // Verified chains
+	"encoding/hex"  // Fingerprint parsing
+	"flag"          // TLS flags
+	"fmt"           // Error formatting
+	"net/http"      // Client transports
+	"os"            // Reading CA certificates
+	"strings"       // Fingerprint normalization
+)
+
+// tlsOptions are the TLS settings of the page and PDF clients, shared by the scraper and
+// the mirror subcommand, see newScraperClients.
+type tlsOptions struct {
+	Fingerprints string // Comma-separated SHA256:<hex> fingerprints of the accepted leaf certificates ("" = no pinning)
+	CACert       string // PEM file of CA certificates trusted in addition to the system roots ("" = none)
+	Insecure     bool   // Skip the certificate verification
+}
+
+// addFlags registers --tls-fingerprint, --ca-cert and --tls-insecure on flags.
+func (opts *tlsOptions) addFlags(flags *flag.FlagSet) {
+	// Pin the TLS certificates of the servers contacted
+	flags.StringVar(&opts.Fingerprints, "tls-fingerprint", "", "comma-separated SHA256:<hex> fingerprints of the accepted leaf certificates (breaks when the CDN rotates its certificates)")
+	// Trust the CA of a corporate TLS inspection proxy
+	flags.StringVar(&opts.CACert, "ca-cert", "", "also trust the CA certificate(s) in this PEM file, e.g. of a corporate TLS inspection proxy (verification stays enabled)")
+	// Accept self-signed certificates of intranet mirrors
+	flags.BoolVar(&opts.Insecure, "tls-insecure", false, "skip TLS certificate verification, e.g. for intranet mirrors with self-signed certificates (insecure)")
+}
+
+// tlsFingerprintPrefix prefixes the fingerprints accepted by --tls-fingerprint.
+const tlsFingerprintPrefix = "SHA256:"
+
+// parseTLSFingerprint parses a "SHA256:<hex>" fingerprint of a DER-encoded
+// certificate. Colons between the hex bytes (as printed by openssl) are allowed.
+func parseTLSFingerprint(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(strings.ToUpper(value), tlsFingerprintPrefix) {
+		return nil, fmt.Errorf("invalid TLS fingerprint %q: expected %s<hex>", value, tlsFingerprintPrefix)
+	}
+	hexDigest := strings.ReplaceAll(value[len(tlsFingerprintPrefix):], ":", "")
+	fingerprint, err := hex.DecodeString(hexDigest)
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("invalid TLS fingerprint %q: expected %d hex-encoded bytes", value, sha256.Size)
+	}
+	return fingerprint, nil
+}
+
+// withPinnedCertificate makes client reject every TLS connection whose leaf
+// certificate does not have one of the given SHA-256 fingerprints. The chain is
+// still verified against the system roots as usual.
+//
+// Pinning breaks as soon as a server rotates its certificate, which CDNs do
+// regularly and without notice: the fingerprints must then be updated by hand.
+func withPinnedCertificate(client *http.Client, fingerprints [][]byte) *http.Client {
+	tlsConfig := transportTLSConfig(client)
+	if tlsConfig == nil {
+		return client // Only the transports built by newHTTPClient can be pinned
+	}
+	// The client keeps no session cache, so every connection runs a full
+	// handshake and the callback sees the certificate of every connection
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("TLS pinning: server sent no certificate")
+		}
+		digest := sha256.Sum256(rawCerts[0]) // Fingerprint of the leaf certificate
+		for _, fingerprint := range fingerprints {
+			if bytes.Equal(digest[:], fingerprint) {
+				return nil
+			}
+		}
+		return fmt.Errorf("TLS pinning: certificate fingerprint %s%X does not match --tls-fingerprint", tlsFingerprintPrefix, digest)
+	}
+	return client
+}
+
+// withInsecureTLS makes client accept any server certificate, e.g. the self-signed
+// certificate of an intranet mirror. Pinned fingerprints are still checked.
+func withInsecureTLS(client *http.Client) *http.Client {
+	if tlsConfig := transportTLSConfig(client); tlsConfig != nil {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return client
+}
+
+// loadCACertPool returns the system roots plus the PEM certificates in the file at path,
+// e.g. the CA of a corporate TLS inspection proxy.
+func loadCACertPool(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool() // No system roots available, trust only the given CA
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// withRootCAs makes client verify server certificates against pool instead of the
+// system roots. Verification stays enabled, unlike withInsecureTLS.
+func withRootCAs(client *http.Client, pool *x509.CertPool) *http.Client {
+	if tlsConfig := transportTLSConfig(client); tlsConfig != nil {
+		tlsConfig.RootCAs = pool
+	}
+	return client
+}
+
+// transportTLSConfig returns the TLS configuration of the client's transport, creating
+// it if needed, or nil when the transport is not an *http.Transport.
+func transportTLSConfig(client *http.Client) *tls.Config {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context" // Context for exporter shutdown
+	"fmt"     // Formatting for error messages
+
+	"go.opentelemetry.io/otel"                                        // Global tracer provider
+	"go.opentelemetry.io/otel/codes"                                  // Span status codes
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp" // OTLP/HTTP span exporter
+	"go.opentelemetry.io/otel/sdk/resource"                           // Service description attached to spans
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"                     // Tracer provider implementation
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"                // Standard attribute keys
+	"go.opentelemetry.io/otel/trace"                                  // Span interface
+)
+
+// tracer creates the spans for page fetches and PDF downloads. Until setupTracing
+// installs a provider it is backed by the global no-op provider.
+var tracer = otel.Tracer("ecolab-scraper")
+
+// setupTracing exports spans to the OTLP/HTTP collector at endpoint (e.g. http://localhost:4318).
+// With an empty endpoint the no-op tracer stays in place. The returned function flushes
+// and stops the exporter and must be called before the program exits.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil // Tracing disabled
+	}
+	// Send the spans to the collector over OTLP/HTTP
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter for %s: %w", endpoint, err)
+	}
+	// Batch the spans and tag them with the service name
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("ecolab-scraper"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// endSpan marks the span as failed when err is not nil and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"       // Request cancellation
+	"encoding/json" // User agent list and cache file
+	"errors"        // Empty list error
+	"fmt"           // Error formatting
+	"io"            // Reading the response body
+	"log/slog"      // Logging the cache state
+	"math/rand/v2"  // Picking a user agent
+	"net/http"      // Fetching the list
+	"os"            // Cache file
+	"path/filepath" // Cache directory
+)
+
+// defaultUserAgent is sent with the page requests when no user agent list is loaded.
+const defaultUserAgent = "Mozilla/5.0 (compatible; EcolabBot/1.0)"
+
+// pageUserAgent returns the User-Agent of the next page request: one of userAgents picked
+// at random, or defaultUserAgent when there are none.
+func pageUserAgent(userAgents []string) string {
+	if len(userAgents) == 0 {
+		return defaultUserAgent
+	}
+	return userAgents[rand.IntN(len(userAgents))]
+}
+
+// userAgentsCacheEntry is the cached user agent list: where it came from, its validators
+// and the user agents.
+type userAgentsCacheEntry struct {
+	URL string `json:"url"` // List the cached copy belongs to
+	pageValidators
+	UserAgents []string `json:"user_agents"`
+}
+
+// errNoUserAgents reports a user agent list without a single entry.
+var errNoUserAgents = errors.New("user agent list is empty")
+
+// loadUserAgents returns the user agents of the JSON array of strings at listURL, e.g.
+// https://jnrbsn.github.io/user-agents/user-agents.json. The list is cached with its ETag /
+// Last-Modified in cachePath and revalidated with a conditional request, so an unchanged
+// list is not downloaded again; when the list cannot be fetched, the cached copy is used.
+func loadUserAgents(ctx context.Context, client *http.Client, listURL string, cachePath string) ([]string, error) {
+	// Read the copy of the previous run, if it belongs to the same list
+	var cached userAgentsCacheEntry
+	if content, err := os.ReadFile(cachePath); err == nil {
+		if json.Unmarshal(content, &cached) != nil || cached.URL != listURL {
+			cached = userAgentsCacheEntry{}
+		}
+	}
+	agents, validators, err := fetchUserAgents(ctx, client, listURL, cached.pageValidators)
+	if errors.Is(err, errPageNotModified) {
+		slog.Debug("User agent list not modified, using the cached copy", "path", cachePath)
+		return cached.UserAgents, nil
+	}
+	if err != nil {
+		if len(cached.UserAgents) > 0 {
+			slog.Warn("Could not update the user agent list, using the cached copy", "error", err, "path", cachePath)
+			return cached.UserAgents, nil
+		}
+		return nil, err
+	}
+	// Cache the new list for the next runs; a failure only costs a download
+	if cachePath != "" {
+		if err := saveUserAgents(cachePath, userAgentsCacheEntry{URL: listURL, pageValidators: validators, UserAgents: agents}); err != nil {
+			slog.Warn("Could not cache the user agent list", "error", err)
+		}
+	}
+	return agents, nil
+}
+
+// fetchUserAgents downloads the user agent list at listURL, conditionally when validators
+// are known. errPageNotModified is returned when the cached list is still current.
+func fetchUserAgents(ctx context.Context, client *http.Client, listURL string, validators pageValidators) ([]string, pageValidators, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, validators, fmt.Errorf("failed to create request for %s: %w", listURL, err)
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	validators.applyTo(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, validators, fmt.Errorf("failed to GET %s: %w", listURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && validators != (pageValidators{}) {
+		return nil, validators, errPageNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, validators, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, listURL)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, validators, fmt.Errorf("failed to read %s: %w", listURL, err)
+	}
+	var agents []string
+	if err := json.Unmarshal(content, &agents); err != nil {
+		return nil, validators, fmt.Errorf("failed to decode user agent list %s: %w", listURL, err)
+	}
+	if len(agents) == 0 {
+		return nil, validators, fmt.Errorf("%w: %s", errNoUserAgents, listURL)
+	}
+	return agents, validatorsFromHeader(resp.Header), nil
+}
+
+// saveUserAgents writes the cached user agent list.
+func saveUserAgents(cachePath string, entry userAgentsCacheEntry) error {
+	if err := ensureDir(0755, filepath.Dir(cachePath)); err != nil {
+		return err
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding user agent list: %w", err)
+	}
+	if err := os.WriteFile(cachePath, content, 0644); err != nil {
+		return fmt.Errorf("error writing user agent cache %s: %w", cachePath, err)
+	}
+	return nil
+}
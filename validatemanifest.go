@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag" // Command line flag parsing
+	"fmt"  // Printing the report
+	"io"   // Report output
+	"log"  // Logging errors
+)
+
+// runValidateManifest implements the "validate-manifest" subcommand: it checks that every
+// manifest entry has a url, checksum and file_path, that no two entries share a url or a
+// file_path and that every file_path exists on disk. It returns the process exit code
+// (1 if any problem was found).
+func runValidateManifest(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate-manifest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	manifestPath := flags.String("manifest", "manifest.json", "path of the manifest to validate")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+
+	// Load the manifest; a file that is not valid JSON is reported here
+	manifest, err := loadManifest(*manifestPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	problems := validateManifest(manifest)
+	for _, problem := range problems {
+		fmt.Fprintln(stdout, problem)
+	}
+	fmt.Fprintf(stdout, "Validated %d entries: %d problems found.\n", len(manifest.Entries), len(problems))
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validateManifest returns a description of every schema or referential integrity problem of the manifest.
+func validateManifest(manifest *Manifest) []string {
+	var problems []string
+	// Remember the first entry of every URL and file path to report duplicates
+	firstByURL := make(map[string]int)
+	firstByFilePath := make(map[string]int)
+	for index, entry := range manifest.Entries {
+		// Describe the entry by its position, since any of its fields may be missing
+		report := func(format string, args ...any) {
+			problems = append(problems, fmt.Sprintf("entry %d: ", index+1)+fmt.Sprintf(format, args...))
+		}
+		// Required fields
+		if entry.URL == "" {
+			report("missing url")
+		}
+		if entry.Checksum.Hash == "" {
+			report("missing checksum")
+		} else if _, err := newChecksumHash(entry.Checksum.Algo); err != nil {
+			report("%v", err)
+		}
+		if entry.FilePath == "" && entry.S3Key == "" { // PDFs streamed to S3 have no local copy
+			report("missing file_path")
+		}
+		// Duplicates
+		if entry.URL != "" {
+			if first, ok := firstByURL[entry.URL]; ok {
+				report("duplicate url %s (also in entry %d)", entry.URL, first+1)
+			} else {
+				firstByURL[entry.URL] = index
+			}
+		}
+		if entry.FilePath != "" {
+			if first, ok := firstByFilePath[entry.FilePath]; ok {
+				report("duplicate file_path %s (also in entry %d)", entry.FilePath, first+1)
+			} else {
+				firstByFilePath[entry.FilePath] = index
+			}
+			// References to files that are gone
+			if !fileExists(entry.FilePath) {
+				report("file_path %s does not exist", entry.FilePath)
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"       // Context for the repair downloads
+	"flag"          // Command line flag parsing
+	"fmt"           // Printing the report
+	"io"            // Report output
+	"log"           // Logging errors
+	"os"            // File removal
+	"path/filepath" // Path manipulation
+)
+
+// runVerify implements the "verify" subcommand: it recomputes the checksum of every
+// file listed in the manifest, with the algorithm recorded for it, and reports missing
+// or corrupt files. PDFs streamed into S3 (--stream-to-s3) have no local file; they are
+// neither checked nor repaired.
+// It returns the process exit code (1 if any corruption was found).
+func runVerify(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	manifestPath := flags.String("manifest", "manifest.json", "path of the manifest to verify")
+	repair := flags.Bool("repair", false, "re-download the files that are missing or corrupt")
+	if err := flags.Parse(args); err != nil {
+		return flagsExitCode(err)
+	}
+
+	// Load the manifest written by the download run
+	manifest, err := loadManifest(*manifestPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	// Check every entry against the file on disk
+	var corrupt []int
+	streamed := 0 // Entries whose only copy is in S3
+	for index, entry := range manifest.Entries {
+		if entry.FilePath == "" && entry.S3Key != "" {
+			streamed++
+			continue
+		}
+		checksum, _, err := hashFile(entry.FilePath, entry.Checksum.Algo)
+		if err != nil {
+			fmt.Fprintf(stdout, "MISSING  %s (%v)\n", entry.FilePath, err)
+			corrupt = append(corrupt, index)
+			continue
+		}
+		if !checksum.matches(entry.Checksum) {
+			fmt.Fprintf(stdout, "CORRUPT  %s (expected %s, got %s)\n", entry.FilePath, entry.Checksum, checksum)
+			corrupt = append(corrupt, index)
+		}
+	}
+	verified := len(manifest.Entries) - streamed
+	fmt.Fprintf(stdout, "Verified %d files: %d ok, %d missing or corrupt.\n", verified, verified-len(corrupt), len(corrupt))
+	if streamed > 0 {
+		fmt.Fprintf(stdout, "Skipped %d PDFs stored only in S3.\n", streamed)
+	}
+	if len(corrupt) == 0 {
+		return 0
+	}
+	if !*repair {
+		fmt.Fprintf(stdout, "Run \"verify --repair --manifest %s\" to re-download only the corrupt files.\n", *manifestPath)
+		return 1
+	}
+
+	// Re-download the corrupt files and record their new checksums
+	client := newHTTPClient(pdfRequestTimeout)
+	repaired := 0
+	for _, index := range corrupt {
+		entry := manifest.Entries[index]
+		// Remove the corrupt copy so downloadPDF does not skip it
+		if err := os.Remove(entry.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Println("Error removing corrupt file:", err)
+			continue
+		}
+		if _, err := downloadPDF(context.Background(), DownloadOptions{Client: client, Stats: &Statistics{}}, entry.SDSLink, filepath.Dir(entry.FilePath), nil); err != nil {
+			log.Println("Error downloading PDF:", err)
+			continue
+		}
+		repairedEntry, err := newManifestEntry(entry.SDSLink, entry.FilePath, entry.Checksum.Algo)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		manifest.Entries[index] = repairedEntry
+		repaired++
+	}
+	if err := manifest.save(*manifestPath); err != nil {
+		log.Println(err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Repaired %d of %d files.\n", repaired, len(corrupt))
+	if repaired != len(corrupt) {
+		return 1
+	}
+	return 0
+}
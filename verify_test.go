@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"             // Captured report
+	"io"                // Discarded usage
+	"net/http"          // Counting the repair downloads
+	"net/http/httptest" // Built-in mock server
+	"os"                // Manifest and PDF files
+	"path/filepath"     // Output paths
+	"strings"           // Checking the report
+	"sync/atomic"       // Request counter
+	"testing"           // Test framework
+)
+
+func TestVerifySkipsStreamedPDFs(t *testing.T) {
+	// Any download would be a repair of the PDF streamed into S3
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "local.pdf")
+	if err := os.WriteFile(localPath, []byte(testPDF), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := newManifestEntry(SDSLink{URL: server.URL + "/local.pdf"}, localPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := ManifestEntry{
+		SDSLink:  SDSLink{URL: server.URL + "/streamed.pdf"},
+		Checksum: Checksum{Algo: "sha256", Hash: "0123"},
+		S3Key:    "sds/streamed.pdf",
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := (&Manifest{Entries: []ManifestEntry{local, streamed}}).save(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if code := runVerify([]string{"--manifest", manifestPath, "--repair"}, &stdout, io.Discard); code != 0 {
+		t.Errorf("verify --repair exit code = %d, want 0", code)
+	}
+	if report := stdout.String(); !strings.Contains(report, "Skipped 1 PDFs stored only in S3.") {
+		t.Errorf("verify report = %q, want the skipped S3 PDFs", report)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("verify --repair downloaded %d PDFs, want none", requests.Load())
+	}
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := manifest.find(streamed.URL); entry == nil || entry.FilePath != "" || entry.S3Key != streamed.S3Key {
+		t.Errorf("streamed entry changed to %+v", entry)
+	}
+}
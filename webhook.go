@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"         // Request body
+	"context"       // Request cancellation
+	"crypto/hmac"   // Payload signing
+	"crypto/sha256" // HMAC hash
+	"encoding/hex"  // Signature encoding
+	"encoding/json" // Payload encoding
+	"fmt"           // Error formatting
+	"log/slog"      // Logging failed notifications
+	"net/http"      // Sending the notification
+	"time"          // Notification timeout
+)
+
+// webhookTimeout bounds a single webhook notification, so a slow receiver never stalls the run.
+const webhookTimeout = 10 * time.Second
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the body as "sha256=<hex>", like GitHub webhooks.
+const webhookSignatureHeader = "X-Signature-256"
+
+// webhookPayload is the JSON body posted at the end of each phase.
+type webhookPayload struct {
+	Phase      string           `json:"phase"`       // "scrape" or "download"
+	Status     string           `json:"status"`      // "success", "failure" or "interrupted"
+	Counts     map[string]int64 `json:"counts"`      // Counters of the phase
+	DurationMS int64            `json:"duration_ms"` // Duration of the phase in milliseconds
+	Errors     []string         `json:"errors"`      // Why the phase failed (empty on success)
+}
+
+// webhookNotifier posts a webhookPayload to a URL, signed when a secret is set.
+type webhookNotifier struct {
+	URL    string       // Endpoint receiving the POST requests
+	Secret string       // Key of the HMAC-SHA256 signature (empty = unsigned)
+	Client *http.Client // Client sending the notifications (nil = default client)
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of body keyed with secret.
+func signWebhookPayload(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) // Writing to a hash never fails
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts the payload and returns an error for transport failures and non-2xx answers.
+func (notifier *webhookNotifier) send(ctx context.Context, payload webhookPayload) error {
+	if payload.Errors == nil {
+		payload.Errors = []string{} // Encode an empty list rather than null
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+	// Notify even when the run was interrupted, but never wait longer than webhookTimeout
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", notifier.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if notifier.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(body, notifier.Secret))
+	}
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	resp.Body.Close()                                   // The answer is not used
+	if resp.StatusCode < 200 || resp.StatusCode > 299 { // Any 2xx acknowledges the notification
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// notify sends the payload and only logs a warning on failure; a webhook never aborts the run.
+// A nil notifier does nothing.
+func (notifier *webhookNotifier) notify(ctx context.Context, payload webhookPayload) {
+	if notifier == nil {
+		return
+	}
+	if err := notifier.send(ctx, payload); err != nil {
+		slog.Warn("Webhook notification failed", "phase", payload.Phase, "url", notifier.URL, "error", err)
+	}
+}
+
+// phaseStatus returns the webhook status of a phase; failed reports whether anything in it failed.
+func phaseStatus(ctx context.Context, failed bool) string {
+	switch {
+	case ctx.Err() != nil:
+		return "interrupted"
+	case failed:
+		return "failure"
+	default:
+		return "success"
+	}
+}